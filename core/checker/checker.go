@@ -0,0 +1,567 @@
+package checker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/ssh"
+	"github.com/axetroy/s4/core/variable"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is found by the static analysis of workflow
+type Problem struct {
+	Severity string
+	*grammar.Error
+}
+
+// state is the knowledge of the workflow at a step
+type state struct {
+	file      string            // the file of current step
+	connected bool              // CONNECT has run
+	cwd       string            // the remote working directory if it is known
+	defined   map[string]bool   // the variables which have been defined
+	literals  map[string]string // the variables whose values are known
+	unknown   bool              // the variables of VARFILE are unknown, so the undefined variables are not reported
+}
+
+func (s *state) copy() *state {
+	c := *s
+
+	c.defined = map[string]bool{}
+	c.literals = map[string]string{}
+
+	for key, value := range s.defined {
+		c.defined[key] = value
+	}
+
+	for key, value := range s.literals {
+		c.literals[key] = value
+	}
+
+	return &c
+}
+
+// merge the states of two branches. The variable is defined if it is defined in any branch
+func (s *state) merge(a, b *state) {
+	s.connected = a.connected && b.connected
+	s.unknown = a.unknown || b.unknown
+
+	if a.cwd != b.cwd {
+		s.cwd = ""
+	} else {
+		s.cwd = a.cwd
+	}
+
+	for key := range a.defined {
+		s.defined[key] = true
+	}
+
+	for key := range b.defined {
+		s.defined[key] = true
+	}
+
+	s.literals = map[string]string{}
+
+	for key, value := range a.literals {
+		if other, ok := b.literals[key]; ok && other == value {
+			s.literals[key] = value
+		}
+	}
+}
+
+type definition struct {
+	name string
+	file string
+	span grammar.Span
+}
+
+type checker struct {
+	macros   map[string]grammar.NodeDefine
+	files    map[string]string   // the files where the tasks and macros are defined
+	sources  map[string][]string // the lines of files
+	problems []Problem
+	reported map[string]bool
+	used     map[string]bool // the variables which are used
+	vars     []definition
+	calling  map[string]bool // the macros which are being called, to avoid the infinite recursion
+}
+
+// Check analyzes the workflow without connecting to the server. The syntax errors are returned as error
+func Check(file string) ([]Problem, error) {
+	tokens, err := grammar.ParseFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	macros, err := grammar.FindMacros(file, tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := grammar.FindTasks(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{
+		macros:   macros,
+		files:    map[string]string{},
+		sources:  map[string][]string{},
+		reported: map[string]bool{},
+		used:     map[string]bool{},
+		calling:  map[string]bool{},
+	}
+
+	var (
+		handlers     []grammar.Token // ON FAILURE and FINALLY
+		handlerFiles []string
+	)
+
+	grammar.Walk(tokens, func(token grammar.Token, f string) bool {
+		if f == "" {
+			f = file
+		}
+
+		switch node := token.Node.(type) {
+		case grammar.NodeTask:
+			c.files[grammar.ActionTASK+" "+node.Name] = f
+		case grammar.NodeDefine:
+			c.files[grammar.ActionDEFINE+" "+node.Name] = f
+		case grammar.NodeOnFailure, grammar.NodeFinally:
+			handlers = append(handlers, token)
+			handlerFiles = append(handlerFiles, f)
+		case grammar.NodeInclude:
+			return true
+		}
+
+		return false
+	})
+
+	s := &state{
+		file:     file,
+		defined:  map[string]bool{},
+		literals: map[string]string{},
+	}
+
+	c.check(s, tokens)
+
+	// the tasks run after the steps outside of tasks
+	for _, task := range tasks {
+		order, err := grammar.ResolveTask(tokens, task.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ts := s.copy()
+
+		for _, t := range order {
+			ts.file = c.files[grammar.ActionTASK+" "+t.Name]
+			c.check(ts, t.Body)
+		}
+	}
+
+	// the handlers run after the steps outside of tasks
+	for i, token := range handlers {
+		hs := s.copy()
+		hs.file = handlerFiles[i]
+
+		switch node := token.Node.(type) {
+		case grammar.NodeOnFailure:
+			hs.defined["FAILED_STEP"] = true
+			hs.defined["ERROR"] = true
+			c.check(hs, node.Body)
+		case grammar.NodeFinally:
+			c.check(hs, node.Body)
+		}
+	}
+
+	for _, v := range c.vars {
+		if !c.used[v.name] {
+			c.report(SeverityWarning, v.file, v.span, "variable `%s` is defined but never used", v.name)
+		}
+	}
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		a, b := c.problems[i].Error, c.problems[j].Error
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Span.Start.Line != b.Span.Start.Line {
+			return a.Span.Start.Line < b.Span.Start.Line
+		}
+		return a.Span.Start.Column < b.Span.Start.Column
+	})
+
+	return c.problems, nil
+}
+
+func (c *checker) report(severity string, file string, span grammar.Span, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	key := fmt.Sprintf("%s:%s:%s", file, span.Start, msg)
+
+	// the steps in tasks and macros may be checked many times
+	if c.reported[key] {
+		return
+	}
+
+	c.reported[key] = true
+
+	lines, ok := c.sources[file]
+
+	if !ok {
+		if b, err := ioutil.ReadFile(file); err == nil {
+			lines = strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+		}
+		c.sources[file] = lines
+	}
+
+	e := &grammar.Error{File: file, Span: span, Msg: msg}
+
+	if line := span.Start.Line; line > 0 && line <= len(lines) {
+		e.Source = lines[line-1]
+	}
+
+	c.problems = append(c.problems, Problem{Severity: severity, Error: e})
+}
+
+// requireConnection reports the remote step which runs before CONNECT
+func (c *checker) requireConnection(s *state, action string, node grammar.Locatable) {
+	if !s.connected {
+		c.report(SeverityError, s.file, node.Location(), "`%s` runs at remote before `%s`", action, grammar.ActionCONNECT)
+	}
+}
+
+// use marks the variables in templates as used, and reports the undefined variables
+func (c *checker) use(s *state, node grammar.Locatable, templates ...string) {
+	for _, template := range templates {
+		for _, reference := range variable.References(template) {
+			c.used[reference.Name] = true
+
+			if !reference.HasDefault && !s.defined[reference.Name] && !s.unknown {
+				c.report(SeverityError, s.file, node.Location(), "undefined variable `%s`", reference.Name)
+			}
+		}
+	}
+}
+
+// resolve returns the value of template if all the variables in it are known
+func (c *checker) resolve(s *state, template string) (string, bool) {
+	for _, reference := range variable.References(template) {
+		if _, ok := s.literals[reference.Name]; !ok && (s.defined[reference.Name] || !reference.HasDefault) {
+			return "", false
+		}
+	}
+
+	value, err := variable.Compile(template, s.literals)
+
+	return value, err == nil
+}
+
+// resolveRemotePath returns the absolute remote path if it is known
+func (c *checker) resolveRemotePath(s *state, template string) (string, bool) {
+	p, ok := c.resolve(s, template)
+
+	switch {
+	case !ok:
+		return "", false
+	case path.IsAbs(p):
+		return path.Clean(p), true
+	case s.cwd != "":
+		return path.Join(s.cwd, p), true
+	default:
+		return "", false
+	}
+}
+
+func (c *checker) command(s *state, action string, node grammar.Locatable, cmd grammar.NodeRunCommand) {
+	switch {
+	case cmd.Script != "":
+		if !cmd.Verbatim {
+			c.use(s, node, cmd.Script)
+		}
+	case cmd.RunInLocal:
+		c.use(s, node, cmd.Command...)
+	default:
+		c.use(s, node, cmd.SourceCode)
+	}
+
+	if !cmd.RunInLocal {
+		c.requireConnection(s, action, node)
+	}
+}
+
+// condition checks the condition of IF and ASSERT
+func (c *checker) condition(s *state, action string, node grammar.Locatable, condition grammar.NodeCondition) {
+	switch {
+	case condition.Compare != nil:
+		c.use(s, node, condition.Compare.Left, condition.Compare.Right)
+	case condition.Exists != nil:
+		c.requireConnection(s, action+" "+grammar.ConditionEXISTS, node)
+		c.use(s, node, condition.Exists.Path)
+	case condition.Command != nil:
+		c.command(s, action+" "+grammar.ActionRUN, node, *condition.Command)
+
+		if condition.Contains != nil {
+			c.use(s, node, *condition.Contains)
+		}
+	}
+}
+
+func (c *checker) check(s *state, tokens []grammar.Token) {
+	for _, token := range tokens {
+		switch node := token.Node.(type) {
+		case grammar.NodeConnect:
+			c.use(s, node, node.Username, node.Host, node.Port)
+
+			if node.Password != nil {
+				c.use(s, node, *node.Password)
+			}
+			s.connected = true
+			s.cwd = ""
+		case grammar.NodeEnv:
+			c.use(s, node, node.Value)
+		case grammar.NodeArg:
+			if node.Default != nil {
+				c.use(s, node, *node.Default)
+			}
+
+			// the value may be from command line
+			s.defined[node.Name] = true
+			delete(s.literals, node.Name)
+		case grammar.NodeVar:
+			c.checkVar(s, node)
+		case grammar.NodeEnvFile:
+			c.use(s, node, node.Path)
+
+			if node.Remote {
+				c.requireConnection(s, token.Key, node)
+			}
+
+			c.checkEnvFile(s, token.Key, node)
+		case grammar.NodeCd:
+			c.requireConnection(s, token.Key, node)
+			c.use(s, node, node.Target)
+
+			cwd, _ := c.resolveRemotePath(s, node.Target)
+			s.cwd = cwd
+		case grammar.NodeUpload:
+			c.requireConnection(s, token.Key, node)
+			c.use(s, node, append(node.SourceFiles, node.DestinationDir)...)
+
+			if token.Key == grammar.ActionUPLOAD {
+				for _, file := range node.SourceFiles {
+					if p, ok := c.resolve(s, file); ok {
+						if _, err := os.Stat(p); os.IsNotExist(err) {
+							c.report(SeverityError, s.file, node.Location(), "local file `%s` does not exist", p)
+						}
+					}
+				}
+			}
+		case grammar.NodeCopy:
+			c.requireConnection(s, token.Key, node)
+			c.use(s, node, node.Source, node.Destination)
+		case grammar.NodeDelete:
+			c.requireConnection(s, token.Key, node)
+			c.use(s, node, node.Targets...)
+
+			for _, target := range node.Targets {
+				if p, ok := c.resolveRemotePath(s, target); ok && ssh.IsLinuxBuildInPath(p) {
+					c.report(SeverityError, s.file, node.Location(), "`%s` target `%s` resolves to the protected path `%s`", token.Key, target, p)
+				}
+			}
+		case grammar.NodeRun:
+			for _, cmd := range node.Commands {
+				c.command(s, token.Key, node, cmd)
+			}
+		case grammar.NodeWait:
+			if node.Remote {
+				c.requireConnection(s, token.Key+" "+grammar.ActionFOR+" "+node.Target, node)
+			}
+
+			c.use(s, node, node.Value, node.Pattern)
+		case grammar.NodeRetry:
+			c.check(s, []grammar.Token{node.Step})
+		case grammar.NodeTimeout:
+			c.check(s, []grammar.Token{node.Step})
+		case grammar.NodeParallel:
+			// the branches run concurrently, they do not change the state of each other and the steps after them
+			for _, branch := range node.Body {
+				c.check(s.copy(), []grammar.Token{branch})
+			}
+		case grammar.NodeAssert:
+			c.condition(s, token.Key, node, node.Condition)
+		case grammar.NodeIf:
+			c.condition(s, token.Key, node, node.Condition)
+
+			then, otherwise := s.copy(), s.copy()
+
+			c.check(then, node.Then)
+			c.check(otherwise, node.Else)
+
+			s.merge(then, otherwise)
+		case grammar.NodeFor:
+			c.use(s, node, node.Items...)
+
+			if node.Command != nil {
+				c.use(s, node, node.Command.Command...)
+
+				if !node.Command.Local {
+					c.requireConnection(s, token.Key, node)
+				}
+			}
+
+			body := s.copy()
+			body.defined[node.Key] = true
+			delete(body.literals, node.Key)
+
+			c.check(body, node.Body)
+
+			// the body may not run
+			if len(node.Items) == 0 {
+				body.connected = s.connected
+			}
+
+			defined := s.defined[node.Key]
+			s.merge(s.copy(), body)
+
+			if !defined {
+				delete(s.defined, node.Key)
+			}
+		case grammar.NodeInclude:
+			file := s.file
+			s.file = node.File
+			c.check(s, node.Body)
+			s.file = file
+		case grammar.NodeCall:
+			c.checkCall(s, node)
+		}
+	}
+}
+
+func (c *checker) checkVar(s *state, node grammar.NodeVar) {
+	keyword := grammar.ActionVAR
+
+	if node.Secret {
+		keyword = grammar.ActionSECRET
+	}
+
+	switch {
+	case node.Env != nil:
+		c.use(s, node, node.Env.Key)
+
+		if !node.Env.Local {
+			c.requireConnection(s, keyword, node)
+		}
+	case node.Command != nil:
+		c.use(s, node, node.Command.Command...)
+
+		for _, name := range variable.PipedExtractors(strings.Join(node.Command.Command, " ")) {
+			c.report(SeverityWarning, s.file, node.Span, "`| %s` runs as a command, the extractors are only taken at the end of command. Write `| command %s` if the command is meant", name, name)
+		}
+
+		if !node.Command.Local {
+			c.requireConnection(s, keyword, node)
+		}
+	}
+
+	s.defined[node.Key] = true
+
+	if node.Literal != nil {
+		s.literals[node.Key] = node.Literal.Value
+	} else {
+		delete(s.literals, node.Key)
+	}
+
+	for _, v := range c.vars {
+		if v.file == s.file && v.span == node.Span {
+			return
+		}
+	}
+
+	c.vars = append(c.vars, definition{name: node.Key, file: s.file, span: node.Span})
+}
+
+// checkEnvFile checks the local env file, and defines the variables of VARFILE
+func (c *checker) checkEnvFile(s *state, action string, node grammar.NodeEnvFile) {
+	p, ok := c.resolve(s, node.Path)
+
+	var (
+		vars map[string]string
+		err  error
+	)
+
+	if ok && !node.Remote {
+		var b []byte
+
+		if b, err = ioutil.ReadFile(p); os.IsNotExist(err) {
+			c.report(SeverityError, s.file, node.Location(), "local file `%s` does not exist", p)
+		} else if err == nil {
+			if vars, err = variable.ParseEnvFile(string(b)); err != nil {
+				c.report(SeverityError, s.file, node.Location(), "invalid env file `%s`: %s", p, err)
+			}
+		}
+	}
+
+	if action != grammar.ActionVARFILE {
+		return
+	}
+
+	if !ok || node.Remote || err != nil {
+		s.unknown = true
+		return
+	}
+
+	for key, value := range vars {
+		s.defined[key] = true
+		s.literals[key] = value
+	}
+}
+
+// checkCall checks the macro with the arguments, the variables in macro do not leak
+func (c *checker) checkCall(s *state, node grammar.NodeCall) {
+	c.use(s, node, node.Args...)
+
+	macro, ok := c.macros[node.Name]
+
+	if !ok || c.calling[node.Name] {
+		return
+	}
+
+	c.calling[node.Name] = true
+
+	defer func() {
+		delete(c.calling, node.Name)
+	}()
+
+	scope := s.copy()
+	scope.file = c.files[grammar.ActionDEFINE+" "+node.Name]
+
+	for i, param := range macro.Params {
+		scope.defined[param] = true
+
+		if value, ok := c.resolve(s, node.Args[i]); ok {
+			scope.literals[param] = value
+		} else {
+			delete(scope.literals, param)
+		}
+	}
+
+	c.check(scope, macro.Body)
+
+	s.connected = scope.connected
+	s.cwd = scope.cwd
+}
@@ -0,0 +1,214 @@
+package checker_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/axetroy/s4/core/checker"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "no problems",
+			content: "VAR dir = /srv/app\nCONNECT root@localhost:22\nCD {{dir}}\nRUN ls\nDELETE dist",
+		},
+		{
+			name:    "remote steps before connect",
+			content: "CD /srv\nRUN ls\nRUN LOCAL ls\nRUN [\"ls\"]\nVAR home = $HOME:remote\nCONNECT root@localhost:22\nRUN echo {{home}}",
+			want: []string{
+				"error 1:1 `CD` runs at remote before `CONNECT`",
+				"error 2:1 `RUN` runs at remote before `CONNECT`",
+				"error 5:1 `VAR` runs at remote before `CONNECT`",
+			},
+		},
+		{
+			name:    "connect in one branch",
+			content: "IF a == b\n  CONNECT root@localhost:22\nEND\nRUN ls",
+			want: []string{
+				"error 4:1 `RUN` runs at remote before `CONNECT`",
+			},
+		},
+		{
+			name:    "templates in address",
+			content: "ARG USER\nCONNECT {{USER}}@{{HOST}}:22\nRUN ls",
+			want: []string{
+				"error 2:1 undefined variable `HOST`",
+			},
+		},
+		{
+			name:    "undefined and unused variables",
+			content: "VAR name = s4\nVAR unused = 1\nRUN LOCAL echo {{name}} {{city}} {{port | default 22}} {{host | upper | default localhost}}",
+			want: []string{
+				"warning 2:1 variable `unused` is defined but never used",
+				"error 3:1 undefined variable `city`",
+			},
+		},
+		{
+			name:    "macro params and loop keys",
+			content: "DEFINE greet(who)\n  RUN LOCAL echo {{who}}\nEND\nFOR f IN a b\n  CALL greet {{f}}\nEND\nRUN LOCAL echo {{who}} {{f}}",
+			want: []string{
+				"error 7:1 undefined variable `who`",
+				"error 7:1 undefined variable `f`",
+			},
+		},
+		{
+			name:    "extractors in the middle of command",
+			content: "VAR size <= LOCAL cat package.json | json .version | wc -c\nVAR name <= LOCAL cat package.json | command json name\nRUN LOCAL echo {{size}} {{name}}",
+			want: []string{
+				"warning 1:1 `| json` runs as a command, the extractors are only taken at the end of command. Write `| command json` if the command is meant",
+			},
+		},
+		{
+			name:    "local upload sources",
+			content: "CONNECT root@localhost:22\nUPLOAD {{dir}}/a.txt missing.txt /srv",
+			want: []string{
+				"error 2:1 undefined variable `dir`",
+				"error 2:1 local file `missing.txt` does not exist",
+			},
+		},
+		{
+			name:    "delete protected paths",
+			content: "VAR root = /\nCONNECT root@localhost:22\nDELETE {{root}}\nCD /usr/local\nDELETE .. bin\nCD {{unknown | upper}}\nDELETE bin",
+			want: []string{
+				"error 3:1 `DELETE` target `{{root}}` resolves to the protected path `/`",
+				"error 5:1 `DELETE` target `..` resolves to the protected path `/usr`",
+				"error 6:1 undefined variable `unknown`",
+			},
+		},
+		{
+			name:    "args",
+			content: "ARG TARGET\nARG REGION = {{TARGET}}-{{zone}}\nRUN LOCAL echo {{REGION}}",
+			want: []string{
+				"error 2:1 undefined variable `zone`",
+			},
+		},
+		{
+			name:    "assert",
+			content: "ASSERT {{VERSION}} == 1.4.2\nASSERT REMOTE FILE /srv/app exists\nASSERT RUN LOCAL curl localhost CONTAINS {{text}}",
+			want: []string{
+				"error 1:1 undefined variable `VERSION`",
+				"error 2:1 `ASSERT EXISTS` runs at remote before `CONNECT`",
+				"error 3:1 undefined variable `text`",
+			},
+		},
+		{
+			name:    "retry",
+			content: "RETRY 3 EVERY 1s RUN curl localhost\nRETRY 3 CONNECT root@localhost:22\nRETRY 2 VAR version <= cat VERSION\nRUN echo {{version}}",
+			want: []string{
+				"error 1:18 `RUN` runs at remote before `CONNECT`",
+			},
+		},
+		{
+			name:    "wait",
+			content: "WAIT FOR PORT 8080\nWAIT FOR FILE /tmp/ready\nWAIT FOR LOG ./app.log MATCHES {{pattern}} ON LOCAL",
+			want: []string{
+				"error 2:1 `WAIT FOR FILE` runs at remote before `CONNECT`",
+				"error 3:1 undefined variable `pattern`",
+			},
+		},
+		{
+			name:    "timeout",
+			content: "TIMEOUT 5m RUN ./deploy.sh\nTIMEOUT 30s RETRY 3 RUN LOCAL echo {{version}}",
+			want: []string{
+				"error 1:12 `RUN` runs at remote before `CONNECT`",
+				"error 2:21 undefined variable `version`",
+			},
+		},
+		{
+			name:    "parallel",
+			content: "PARALLEL\n  RUN LOCAL echo {{name}}\n  IF a == a\n    RUN ls\n  END\nEND",
+			want: []string{
+				"error 2:3 undefined variable `name`",
+				"error 4:5 `RUN` runs at remote before `CONNECT`",
+			},
+		},
+		{
+			name:    "handlers",
+			content: "ON FAILURE\n  RUN LOCAL echo {{FAILED_STEP}} {{ERROR}}\n  RUN ln -sfn /srv/prev /srv/current\nEND\nFINALLY\n  RUN LOCAL echo {{ERROR}}\nEND\nCONNECT root@localhost:22",
+			want: []string{
+				"error 6:3 undefined variable `ERROR`",
+			},
+		},
+		{
+			name:    "syntax error",
+			content: "FOO bar",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".s4")
+
+			if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, err := checker.Check(file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var got []string
+
+			for _, p := range problems {
+				got = append(got, fmt.Sprintf("%s %s %s", p.Severity, p.Span.Start, p.Msg))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "vars.env")
+	file := filepath.Join(dir, ".s4")
+
+	if err := ioutil.WriteFile(envFile, []byte("TARGET=prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := fmt.Sprintf(
+		"VARFILE %s\nENVFILE %s/missing.env\nRUN LOCAL echo {{TARGET}} {{REGION}}\nVARFILE .env:remote\nRUN LOCAL echo {{REGION}}",
+		envFile,
+		dir,
+	)
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := checker.Check(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, p := range problems {
+		got = append(got, fmt.Sprintf("%s %s %s", p.Severity, p.Span.Start, p.Msg))
+	}
+
+	want := []string{
+		fmt.Sprintf("error 2:1 local file `%s/missing.env` does not exist", dir),
+		"error 3:1 undefined variable `REGION`",
+		"error 4:1 `VARFILE` runs at remote before `CONNECT`",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/axetroy/s4/core/checker"
+	"github.com/fatih/color"
+)
+
+// Check validates the s4 files without connecting to the server.
+// An error is returned if there is any error-level problem, the warnings are only printed
+func Check(files []string) error {
+	var errorCount, warningCount int
+
+	for _, file := range files {
+		problems, err := checker.Check(file)
+
+		if err != nil {
+			return err
+		}
+
+		for _, problem := range problems {
+			if problem.Severity == checker.SeverityError {
+				errorCount++
+				fmt.Printf("%s %s\n\n", color.RedString("error:"), problem.Error)
+			} else {
+				warningCount++
+				fmt.Printf("%s %s\n\n", color.YellowString("warning:"), problem.Error)
+			}
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("%d error(s) and %d warning(s) found", errorCount, warningCount)
+	}
+
+	if warningCount > 0 {
+		fmt.Printf("%d warning(s) found.\n", warningCount)
+	} else {
+		fmt.Println(color.GreenString("No problems found."))
+	}
+
+	return nil
+}
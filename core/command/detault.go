@@ -1,15 +1,22 @@
 package command
 
-import "github.com/axetroy/s4/core/runner"
+import (
+	"time"
+
+	"github.com/axetroy/s4/core/runner"
+)
 
 // Default task
-func Default(configFile string) error {
+func Default(configFile string, vars map[string]string, timeout time.Duration) error {
 	r, err := runner.NewRunner(configFile)
 
 	if err != nil {
 		return err
 	}
 
+	r.SetVariables(vars)
+	r.SetTimeout(timeout)
+
 	if err := r.Run(); err != nil {
 		return err
 	}
@@ -0,0 +1,155 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the lines of context around the changes
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script from a to b, base on the longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// unifiedDiff returns the changes from a to b in unified format
+func unifiedDiff(file string, a, b string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+
+	out.WriteString(fmt.Sprintf("--- %s\n+++ %s (formatted)\n", file, file))
+
+	// the line numbers of a and b before each operation
+	lineA, lineB := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	lineA[0], lineB[0] = 1, 1
+
+	for k, op := range ops {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if op.kind != '+' {
+			lineA[k+1]++
+		}
+		if op.kind != '-' {
+			lineB[k+1]++
+		}
+	}
+
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// extend the hunk until there are enough unchanged lines after the changes
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			n := 0
+			for end+n < len(ops) && ops[end+n].kind == ' ' {
+				n++
+			}
+
+			if end+n == len(ops) || n > diffContext*2 {
+				end += minInt(n, diffContext)
+				break
+			}
+
+			end += n
+		}
+
+		countA, countB := lineA[end]-lineA[start], lineB[end]-lineB[start]
+
+		out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", lineA[start], countA, lineB[start], countB))
+
+		for _, op := range ops[start:end] {
+			line := op.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			out.WriteString(string(op.kind) + line)
+		}
+
+		k = end
+	}
+
+	return out.String()
+}
+
+// splitLines splits the text into lines, the line breaks are kept
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/fatih/color"
+)
+
+// Fmt rewrites the s4 files in canonical form.
+// With check, the files are not written and an error is returned if any of them is not formatted.
+// With diff, the changes are printed instead of writing the files
+func Fmt(files []string, check bool, diff bool) error {
+	var unformatted []string
+
+	for _, file := range files {
+		if grammar.IsDocument(file) {
+			return fmt.Errorf("`%s` is a YAML/JSON workflow, only the s4 files can be formatted", file)
+		}
+
+		b, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		source := string(b)
+
+		formatted, err := grammar.Format(file, source)
+
+		if err != nil {
+			return err
+		}
+
+		if formatted == source {
+			continue
+		}
+
+		unformatted = append(unformatted, file)
+
+		if diff {
+			fmt.Print(unifiedDiff(file, source, formatted))
+		}
+
+		if check || diff {
+			continue
+		}
+
+		stat, err := os.Stat(file)
+
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(file, []byte(formatted), stat.Mode()); err != nil {
+			return err
+		}
+
+		fmt.Printf("Formatted `%s`.\n", color.GreenString(file))
+	}
+
+	if check && len(unformatted) > 0 {
+		for _, file := range unformatted {
+			fmt.Println(file)
+		}
+
+		return fmt.Errorf("%d file(s) are not formatted, run 's4 fmt' to format them", len(unformatted))
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package command
+
+import (
+	"os"
+
+	"github.com/axetroy/s4/core/lsp"
+)
+
+// Lsp runs the language server over stdio
+func Lsp() error {
+	return lsp.NewServer(os.Stdin, os.Stdout).Serve()
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/fatih/color"
+)
+
+// parseVersion is the version of JSON output of `s4 parse --json`.
+// It is increased when the fields are renamed or removed, adding fields does not change it
+const parseVersion = 1
+
+type parseOutput struct {
+	Version int             `json:"version"`
+	File    string          `json:"file"`
+	Tokens  []grammar.Token `json:"tokens"`
+}
+
+// Parse prints the tokens of s4 file, the files of INCLUDE are spliced in.
+// With asJSON, the tokens are printed as JSON for the other tools
+func Parse(file string, asJSON bool) error {
+	tokens, err := grammar.ParseFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(parseOutput{
+			Version: parseVersion,
+			File:    file,
+			Tokens:  tokens,
+		})
+	}
+
+	printTokens(tokens, 0)
+
+	return nil
+}
+
+// printTokens prints the outline of tokens. eg. `3:1 RUN`
+func printTokens(tokens []grammar.Token, depth int) {
+	for _, token := range tokens {
+		location := ""
+
+		if node, ok := token.Node.(grammar.Locatable); ok {
+			location = node.Location().Start.String()
+		}
+
+		fmt.Printf("%s%s %s\n", strings.Repeat("  ", depth), color.GreenString(token.Key), location)
+
+		for _, children := range grammar.Children(token) {
+			printTokens(children, depth+1)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/axetroy/s4/core/runner"
+	"github.com/fatih/color"
+)
+
+// Run a task and its dependencies
+func Run(configFile string, task string, vars map[string]string, timeout time.Duration) error {
+	r, err := runner.NewRunner(configFile)
+
+	if err != nil {
+		return err
+	}
+
+	r.SetVariables(vars)
+	r.SetTimeout(timeout)
+
+	if task != "" {
+		return r.RunTask(task)
+	}
+
+	tasks, err := r.Tasks()
+
+	if err != nil {
+		return err
+	}
+
+	if len(tasks) == 0 {
+		return errors.New("there is no task defined")
+	}
+
+	fmt.Println("Available tasks:")
+
+	for _, t := range tasks {
+		if len(t.Depends) > 0 {
+			fmt.Printf("  %s (depends on %s)\n", color.GreenString(t.Name), strings.Join(t.Depends, ", "))
+		} else {
+			fmt.Printf("  %s\n", color.GreenString(t.Name))
+		}
+	}
+
+	return errors.New("require a task name, eg. 's4 run <task>'")
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/axetroy/s4/core/variable"
+)
+
+var varPairReg = regexp.MustCompile(`^\w+$`)
+
+// Variables returns the variables from the env files and the `KEY=VALUE` pairs of command line.
+// The later ones take precedence, so `--var` overrides `--var-file`
+func Variables(files []string, pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fileVars, err := variable.ParseEnvFile(string(b))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+
+		for key, value := range fileVars {
+			vars[key] = value
+		}
+	}
+
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+
+		if i < 0 || !varPairReg.MatchString(pair[:i]) {
+			return nil, fmt.Errorf("invalid variable `%s`, expect `KEY=VALUE`", pair)
+		}
+
+		vars[pair[:i]] = pair[i+1:]
+	}
+
+	return vars, nil
+}
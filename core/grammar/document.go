@@ -0,0 +1,374 @@
+package grammar
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the fields of block steps in YAML/JSON workflow
+const (
+	fieldThen  = "then"  // the steps of IF
+	fieldElse  = "else"  // the steps of ELSE
+	fieldSteps = "steps" // the steps of FOR, TASK, DEFINE, PARALLEL, ON FAILURE and FINALLY
+)
+
+// blockFields are the fields which are accepted by the keyword besides the keyword itself
+var blockFields = map[string][]string{
+	ActionIF:       {fieldThen, fieldElse},
+	ActionFOR:      {fieldSteps},
+	ActionTASK:     {fieldSteps},
+	ActionDEFINE:   {fieldSteps},
+	ActionPARALLEL: {fieldSteps},
+	ActionON:       {fieldSteps},
+	ActionFINALLY:  {fieldSteps},
+}
+
+// yamlErrorReg matches the syntax error of YAML. eg. `yaml: line 1: did not find expected key`
+var yamlErrorReg = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// IsDocument reports whether the file is a YAML/JSON workflow by the extension. eg. deploy.s4.yaml
+func IsDocument(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+
+	return false
+}
+
+// ParseDocument parses the YAML/JSON workflow. It is a list of steps, each step is a keyword with its arguments,
+// the arguments are written as they are in s4 file, or as a list of arguments. eg.
+//
+//	# deploy.s4.yaml
+//	- connect: root@192.168.0.1:22
+//	- upload: [./dist, /srv/app]
+//	- if: "{{ENV}} == prod"
+//	  then:
+//	    - run: npm run build
+//	  else:
+//	    - run: npm run dev
+//
+// The steps are converted into the statements of s4, so they are parsed into the same tokens as s4 file
+func ParseDocument(file string, input string) ([]Token, error) {
+	d := &documentParser{
+		file:  file,
+		lines: splitLines(input),
+	}
+
+	// JSON is parsed as YAML, which does not allow tabs as indentation
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		input = strings.ReplaceAll(input, "\t", " ")
+	}
+
+	var root yaml.Node
+
+	if err := yaml.Unmarshal([]byte(input), &root); err != nil {
+		line, msg := 1, err.Error()
+
+		if m := yamlErrorReg.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = msg[len(m[0]):]
+		}
+
+		pos := Position{Line: line, Column: 1}
+
+		return nil, ErrorList{newError(file, d.lines, Span{Start: pos, End: pos}, "invalid document: "+msg)}.Err()
+	}
+
+	// the document is empty
+	if len(root.Content) > 0 {
+		d.steps(root.Content[0])
+	}
+
+	d.items = append(d.items, item{typ: itemEOF, span: Span{Start: d.last, End: d.last}, offset: d.b.Len(), end: d.b.Len()})
+
+	p := &parser{
+		file:  file,
+		input: d.b.String(),
+		lines: d.lines,
+		items: d.items,
+	}
+
+	tokens, _, _ := p.parseBlock()
+
+	return tokens, append(d.errors, p.errors...).Err()
+}
+
+// documentParser converts the steps into the items of s4 statements
+type documentParser struct {
+	file   string
+	lines  []string
+	b      strings.Builder // the statements in s4 syntax, the items refer to it
+	items  []item
+	last   Position // the end of last item
+	errors ErrorList
+}
+
+func (d *documentParser) errorf(node *yaml.Node, format string, a ...interface{}) {
+	pos := Position{Line: node.Line, Column: node.Column}
+
+	d.errors = append(d.errors, newError(d.file, d.lines, Span{Start: pos, End: pos}, fmt.Sprintf(format, a...)))
+}
+
+func alias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func (d *documentParser) steps(node *yaml.Node) {
+	node = alias(node)
+
+	if node.Kind != yaml.SequenceNode {
+		d.errorf(node, "expect a list of steps")
+		return
+	}
+
+	for _, step := range node.Content {
+		d.step(alias(step))
+	}
+}
+
+func (d *documentParser) step(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		d.errorf(node, "expect a step like `run: <command>`")
+		return
+	}
+
+	var (
+		keyNode   *yaml.Node
+		valueNode *yaml.Node
+		fields    = map[string]*yaml.Node{}
+		fieldKeys []*yaml.Node
+	)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], alias(node.Content[i+1])
+
+		switch name := key.Value; {
+		case name == fieldThen || name == fieldElse || name == fieldSteps:
+			fields[name] = value
+			fieldKeys = append(fieldKeys, key)
+		case isAction(strings.ToUpper(name)) && !strings.EqualFold(name, ActionELSE) && !strings.EqualFold(name, ActionEND):
+			if keyNode != nil {
+				d.errorf(key, "a step only accepts one keyword but got `%s` and `%s`", keyNode.Value, name)
+				continue
+			}
+			keyNode, valueNode = key, value
+		default:
+			d.errorf(key, "unknown field `%s`", name)
+		}
+	}
+
+	if keyNode == nil {
+		d.errorf(node, "missing the keyword of step")
+		return
+	}
+
+	keyword := strings.ToUpper(keyNode.Value)
+
+	for _, key := range fieldKeys {
+		accepted := false
+
+		for _, field := range blockFields[keyword] {
+			accepted = accepted || field == key.Value
+		}
+
+		if !accepted {
+			d.errorf(key, "`%s` does not accept the field `%s`", keyword, key.Value)
+		}
+	}
+
+	if !d.statement(keyword, keyNode, valueNode) {
+		return
+	}
+
+	switch keyword {
+	case ActionIF:
+		d.block(fields[fieldThen])
+
+		if node, ok := fields[fieldElse]; ok {
+			d.keyword(ActionELSE)
+			d.block(node)
+		}
+
+		d.keyword(ActionEND)
+	case ActionFOR, ActionTASK, ActionDEFINE, ActionPARALLEL, ActionON, ActionFINALLY:
+		d.block(fields[fieldSteps])
+		d.keyword(ActionEND)
+	}
+}
+
+func (d *documentParser) block(node *yaml.Node) {
+	// the block is empty
+	if node == nil || (node.Kind == yaml.ScalarNode && node.Tag == "!!null") {
+		return
+	}
+
+	d.steps(node)
+}
+
+// segment is a range of the statement which comes from a node
+type segment struct {
+	start int      // the byte offset in statement
+	pos   Position // the position of the start in document
+	fixed bool     // all the items in segment are at pos, for multiple lines
+}
+
+// statement writes the keyword with the arguments as a line of s4. It returns false if the arguments are invalid
+func (d *documentParser) statement(keyword string, keyNode *yaml.Node, valueNode *yaml.Node) bool {
+	line := keyword
+	segments := []segment{{start: 0, pos: Position{Line: keyNode.Line, Column: keyNode.Column}}}
+
+	valuePos := Position{Line: valueNode.Line, Column: valueNode.Column}
+
+	// the quotes are not part of the value
+	if valueNode.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+		valuePos.Column++
+	}
+
+	switch {
+	case valueNode.Kind == yaml.ScalarNode && valueNode.Tag == "!!null":
+		// no arguments
+	case valueNode.Kind == yaml.ScalarNode:
+		value := strings.TrimRight(valueNode.Value, "\n")
+
+		if !strings.Contains(value, "\n") {
+			line += spaceBlank
+			segments = append(segments, segment{start: len(line), pos: valuePos})
+			line += value
+			break
+		}
+
+		line += spaceBlank
+
+		if keyword == ActionRUN || keyword == ActionTRY || keyword == ActionLOCAL {
+			// the lines are the script
+			delimiter := "EOF"
+
+			for containsLine(value, delimiter) {
+				delimiter += "_"
+			}
+
+			segments = append(segments, segment{start: len(line), pos: valuePos, fixed: true})
+			line += "<<" + delimiter + "\n" + value + "\n" + delimiter
+			break
+		}
+
+		// the lines are continued as s4 does
+		segments = append(segments, segment{start: len(line), pos: valuePos, fixed: true})
+		line += strings.Join(strings.Fields(value), spaceBlank)
+	case valueNode.Kind == yaml.SequenceNode:
+		for _, element := range valueNode.Content {
+			element = alias(element)
+
+			if element.Kind != yaml.ScalarNode {
+				d.errorf(element, "expect a string as the argument of `%s`", keyword)
+				return false
+			}
+
+			pos := Position{Line: element.Line, Column: element.Column}
+
+			line += spaceBlank
+			segments = append(segments, segment{start: len(line), pos: pos, fixed: true})
+			line += quoteArgument(element.Value)
+		}
+	default:
+		d.errorf(valueNode, "expect a string or a list of strings as the arguments of `%s`", keyword)
+		return false
+	}
+
+	base := d.b.Len()
+
+	d.b.WriteString(line + "\n")
+
+	// the position in document of the byte offset in statement
+	position := func(offset int) Position {
+		s := segments[0]
+
+		for _, seg := range segments {
+			if seg.start <= offset {
+				s = seg
+			}
+		}
+
+		if s.fixed {
+			return s.pos
+		}
+
+		return Position{Line: s.pos.Line, Column: s.pos.Column + utf8.RuneCountInString(line[s.start:offset])}
+	}
+
+	for _, it := range lex(line) {
+		if it.typ == itemEOF {
+			break
+		}
+
+		start := position(it.offset)
+		end := start
+
+		if !strings.Contains(line[it.offset:it.end], "\n") && position(it.end) != start {
+			end = Position{Line: start.Line, Column: start.Column + utf8.RuneCountInString(line[it.offset:it.end])}
+		}
+
+		it.span = Span{Start: start, End: end}
+		it.offset += base
+		it.end += base
+
+		d.items = append(d.items, it)
+		d.last = end
+	}
+
+	if n := len(d.items); n == 0 || d.items[n-1].typ != itemNewline {
+		d.newline()
+	}
+
+	return true
+}
+
+// keyword writes the keyword without arguments. eg. END
+func (d *documentParser) keyword(keyword string) {
+	offset := d.b.Len()
+
+	d.b.WriteString(keyword + "\n")
+
+	d.items = append(d.items, item{typ: itemWord, val: keyword, span: Span{Start: d.last, End: d.last}, offset: offset, end: offset + len(keyword)})
+
+	d.newline()
+}
+
+func (d *documentParser) newline() {
+	offset := d.b.Len() - 1
+
+	d.items = append(d.items, item{typ: itemNewline, val: "\n", span: Span{Start: d.last, End: d.last}, offset: offset, end: offset + 1})
+}
+
+// containsLine reports whether there is a line which ends the heredoc
+func containsLine(text string, delimiter string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == delimiter {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quoteArgument quotes the argument if it contains the special characters, so it is lexed as one word
+func quoteArgument(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"'\\#") {
+		return arg
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+	return `"` + replacer.Replace(arg) + `"`
+}
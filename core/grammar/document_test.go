@@ -0,0 +1,148 @@
+package grammar_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+// withoutSpans returns the tokens as JSON values without the positions, which are different between formats
+func withoutSpans(t *testing.T, tokens []grammar.Token) interface{} {
+	b, err := json.Marshal(tokens)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v interface{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	var strip func(v interface{})
+
+	strip = func(v interface{}) {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			delete(value, "start")
+			delete(value, "end")
+			for _, child := range value {
+				strip(child)
+			}
+		case []interface{}:
+			for _, child := range value {
+				strip(child)
+			}
+		}
+	}
+
+	strip(v)
+
+	return v
+}
+
+func TestParseDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		input string
+		want  string // the same workflow in s4
+	}{
+		{
+			name:  "yaml",
+			file:  "deploy.s4.yaml",
+			input: "- connect: root@192.168.0.1:22\n- var: version <= node -v\n- upload: [./dist, \"my file.txt\", /srv]\n- run: npm run build && npm test\n- Try: exit 1\n- run: |\n    cd /srv\n    echo {{version}}\n",
+			want:  "CONNECT root@192.168.0.1:22\nVAR version <= node -v\nUPLOAD ./dist \"my file.txt\" /srv\nRUN npm run build && npm test\nTRY exit 1\nRUN <<EOF\ncd /srv\necho {{version}}\nEOF\n",
+		},
+		{
+			name:  "blocks",
+			file:  "deploy.s4.yml",
+			input: "- define: restart(service)\n  steps:\n    - run: systemctl restart {{service}}\n- task: deploy DEPENDS build\n  steps:\n    - for: s IN api web\n      steps:\n        - call: restart {{s}}\n- task: build\n- if: \"{{ENV}} == prod\"\n  then:\n    - cd: /srv\n  else:\n    - if: NOT EXISTS /tmp\n      then:\n        - cd: /tmp\n",
+			want:  "DEFINE restart(service)\nRUN systemctl restart {{service}}\nEND\nTASK deploy DEPENDS build\nFOR s IN api web\nCALL restart {{s}}\nEND\nEND\nTASK build\nEND\nIF {{ENV}} == prod\nCD /srv\nELSE\nIF NOT EXISTS /tmp\nCD /tmp\nEND\nEND\n",
+		},
+		{
+			name:  "json",
+			file:  "deploy.s4.json",
+			input: "[\n\t{\"connect\": \"root@192.168.0.1:22\"},\n\t{\"env\": [\"GREETING\", \"=\", \"hello world\"]},\n\t{\"run\": \"[\\\"ls\\\", \\\"-l\\\"]\"}\n]\n",
+			want:  "CONNECT root@192.168.0.1:22\nENV GREETING = \"hello world\"\nRUN [\"ls\", \"-l\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grammar.ParseDocument(tt.file, tt.input)
+
+			if err != nil {
+				t.Fatalf("ParseDocument() error = %v", err)
+			}
+
+			want, err := grammar.Parse(".s4", tt.want)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(withoutSpans(t, got), withoutSpans(t, want)) {
+				g, _ := json.Marshal(withoutSpans(t, got))
+				w, _ := json.Marshal(withoutSpans(t, want))
+				t.Errorf("ParseDocument() = %s\nwant %s", g, w)
+			}
+		})
+	}
+}
+
+func TestParseDocumentError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "invalid yaml",
+			input: "- run: [a\n",
+			want:  "deploy.s4.yaml:1:1: invalid document: did not find expected ',' or ']'",
+		},
+		{
+			name:  "not a list",
+			input: "run: ls\n",
+			want:  "deploy.s4.yaml:1:1: expect a list of steps",
+		},
+		{
+			name:  "unknown field",
+			input: "- run: ls\n  foo: bar\n",
+			want:  "deploy.s4.yaml:2:3: unknown field `foo`",
+		},
+		{
+			name:  "field of other keyword",
+			input: "- cd: /srv\n  steps: []\n",
+			want:  "deploy.s4.yaml:2:3: `CD` does not accept the field `steps`",
+		},
+		{
+			name:  "two keywords",
+			input: "- run: ls\n  cd: /srv\n",
+			want:  "deploy.s4.yaml:2:3: a step only accepts one keyword but got `run` and `cd`",
+		},
+		{
+			name:  "syntax error at the position of value",
+			input: "- connect: root@192.168.0.1:22\n- cd: /srv /tmp\n",
+			want:  "deploy.s4.yaml:2:7: `CD` only accepts one string but got `/srv /tmp`",
+		},
+		{
+			name:  "task in block",
+			input: "- for: f IN a\n  steps:\n    - task: build\n",
+			want:  "deploy.s4.yaml:3:7: `TASK` is only allowed at the top level",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := grammar.ParseDocument("deploy.s4.yaml", tt.input)
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("ParseDocument() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
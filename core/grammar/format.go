@@ -0,0 +1,375 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/axetroy/s4/core/host"
+)
+
+// assignReg matches the assignment of VAR, SECRET, ENV and ARG. eg. `KEY=value`, `KEY <= command`
+var assignReg = regexp.MustCompile(`^(\w+)\s*(<?=)\s*`)
+
+const (
+	indentBlock        = "  "   // the indentation of statements in block
+	indentContinuation = "    " // the indentation of continued lines
+)
+
+// Format rewrites the s4 source in canonical form:
+//   - keywords are uppercase
+//   - statements in blocks are indented with 2 spaces
+//   - arguments are separated by one space, and `=` or `<=` of VAR, SECRET, ENV and ARG is surrounded by one space
+//   - the backslashes of line continuations are aligned
+//   - comments and heredoc are kept, consecutive blank lines are collapsed into one
+//
+// The syntax errors are returned if the source is invalid. The formatted source is parsed again, so it is always valid
+func Format(file string, input string) (string, error) {
+	// keywords are uppercased in place, so the positions of syntax errors are the same as the source
+	input = normalizeKeywords(input)
+
+	if _, err := Parse(file, input); err != nil {
+		return "", err
+	}
+
+	f := &formatter{input: input}
+
+	for _, l := range splitStatements(lex(input)) {
+		f.format(l)
+	}
+
+	output := strings.TrimLeft(f.b.String(), "\n")
+
+	// the formatted source must be valid as the source, otherwise it is a bug of formatter
+	if _, err := Parse(file, output); err != nil {
+		return "", fmt.Errorf("the formatted source is invalid: %s", err)
+	}
+
+	return output, nil
+}
+
+// sourceLine is a statement or a comment line of the source
+type sourceLine struct {
+	words   []item
+	comment *item
+	heredoc *item
+}
+
+// splitStatements splits the items by the end of line. The line continuations have been swallowed by lexer
+func splitStatements(items []item) []sourceLine {
+	var (
+		lines   []sourceLine
+		current sourceLine
+	)
+
+	for _, it := range items {
+		switch it.typ {
+		case itemWord:
+			current.words = append(current.words, it)
+		case itemComment:
+			comment := it
+			current.comment = &comment
+		case itemHeredoc:
+			heredoc := it
+			current.heredoc = &heredoc
+		case itemNewline, itemEOF:
+			lines = append(lines, current)
+			current = sourceLine{}
+		}
+	}
+
+	return lines
+}
+
+type formatter struct {
+	input string
+	b     strings.Builder
+	depth int
+	blank bool // there are blank lines before the next statement
+}
+
+func (f *formatter) raw(it item) string {
+	return f.input[it.offset:it.end]
+}
+
+func (f *formatter) format(l sourceLine) {
+	if len(l.words) == 0 && l.comment == nil {
+		f.blank = f.b.Len() > 0
+		return
+	}
+
+	if f.blank {
+		f.b.WriteString("\n")
+		f.blank = false
+	}
+
+	if len(l.words) == 0 {
+		f.writeLines([]string{f.raw(*l.comment)}, f.depth)
+		return
+	}
+
+	keyword := l.words[0].val
+	depth := f.depth
+
+	switch keyword {
+	case ActionEND:
+		f.depth--
+		depth = f.depth
+	case ActionELSE:
+		depth = f.depth - 1
+	case ActionIF, ActionFOR, ActionTASK, ActionDEFINE, ActionPARALLEL, ActionON, ActionFINALLY:
+		f.depth++
+	}
+
+	lines := f.statementLines(l.words[0], l.words[1:])
+
+	if l.comment != nil {
+		lines[len(lines)-1] += " " + f.raw(*l.comment)
+	}
+
+	f.writeLines(lines, depth)
+
+	if l.heredoc != nil {
+		// the body and the delimiter line are kept verbatim
+		f.b.WriteString(f.input[l.heredoc.offset:l.heredoc.end])
+		f.b.WriteString("\n")
+	}
+}
+
+// statementLines returns the lines of statement. A statement is continued on multiple lines as it is in the source
+func (f *formatter) statementLines(keywordItem item, args []item) []string {
+	keyword := keywordItem.val
+
+	var lines []string
+
+	for i := 0; i < len(args); {
+		j := i
+		for j+1 < len(args) && args[j+1].span.Start.Line == args[i].span.Start.Line {
+			j++
+		}
+
+		switch keyword {
+		case ActionRUN, ActionTRY, ActionLOCAL, ActionVAR, ActionSECRET, ActionENV, ActionARG, ActionRETRY, ActionTIMEOUT:
+			// the spaces are significant in the commands and values
+			lines = append(lines, f.input[args[i].offset:args[j].end])
+		default:
+			var words []string
+			for _, arg := range args[i : j+1] {
+				words = append(words, f.raw(arg))
+			}
+			lines = append(lines, strings.Join(words, spaceBlank))
+		}
+
+		i = j + 1
+	}
+
+	if len(lines) == 0 {
+		return []string{keyword}
+	}
+
+	switch keyword {
+	case ActionVAR, ActionSECRET, ActionENV, ActionARG:
+		lines[0] = strings.TrimSpace(assignReg.ReplaceAllString(lines[0], "$1 $2 "))
+	case ActionDEFINE:
+		if m := defineReg.FindStringSubmatch(lines[0]); m != nil && strings.Contains(lines[0], "(") {
+			var params []string
+			for _, param := range strings.Split(m[2], ",") {
+				if param = strings.TrimSpace(param); param != "" {
+					params = append(params, param)
+				}
+			}
+			lines[0] = m[1] + "(" + strings.Join(params, ", ") + ")"
+		}
+	}
+
+	// the arguments may start from the next line of keyword
+	if args[0].span.Start.Line == keywordItem.span.Start.Line {
+		lines[0] = keyword + spaceBlank + lines[0]
+	} else {
+		lines = append([]string{keyword}, lines...)
+	}
+
+	return lines
+}
+
+// writeLines writes the lines of a statement, the backslashes of continued lines are aligned
+func (f *formatter) writeLines(lines []string, depth int) {
+	indent := strings.Repeat(indentBlock, depth)
+
+	width := 0
+
+	for i, line := range lines[:len(lines)-1] {
+		if i > 0 {
+			line = indentContinuation + line
+		}
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+
+	for i, line := range lines {
+		if i > 0 {
+			line = indentContinuation + line
+		}
+
+		f.b.WriteString(indent + line)
+
+		if i < len(lines)-1 {
+			f.b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(line)) + " \\")
+		}
+
+		f.b.WriteString("\n")
+	}
+}
+
+// keywordAt reports whether the word is the keyword, regardless of case
+func keywordAt(input string, it item, keyword string) bool {
+	raw := input[it.offset:it.end]
+
+	return len(raw) == len(keyword) && strings.ToUpper(raw) == keyword
+}
+
+// normalizeKeywords uppercases the keywords in place. eg. `run ls` => `RUN ls`, `for x in a b` => `FOR x IN a b`
+func normalizeKeywords(input string) string {
+	b := []byte(input)
+
+	upper := func(words []item, i int, keyword string) bool {
+		if i >= len(words) || !keywordAt(input, words[i], keyword) {
+			return false
+		}
+		copy(b[words[i].offset:words[i].end], keyword)
+		return true
+	}
+
+	isOperator := func(it item) bool {
+		return it.val == OperatorEqual || it.val == OperatorNotEqual
+	}
+
+	condition := func(args []item) {
+		if upper(args, 0, ConditionNOT) {
+			args = args[1:]
+		}
+
+		// `<left> == <right>` may compare the words which look like keywords
+		if len(args) == 3 && isOperator(args[1]) {
+			return
+		}
+
+		if len(args) == 2 {
+			upper(args, 0, ConditionEXISTS)
+		}
+
+		if len(args) == 4 && upper(args, 0, KeywordREMOTE) {
+			upper(args, 1, KeywordFILE)
+			upper(args, 3, ConditionEXISTS)
+		}
+
+		if len(args) >= 2 && upper(args, 0, ActionRUN) && len(args) >= 3 {
+			upper(args, 1, ActionLOCAL)
+		}
+	}
+
+	var normalize func(words []item)
+
+	normalize = func(words []item) {
+		if len(words) == 0 {
+			return
+		}
+
+		keyword := strings.ToUpper(input[words[0].offset:words[0].end])
+
+		if !isAction(keyword) || !upper(words, 0, keyword) {
+			return
+		}
+
+		switch keyword {
+		case ActionCONNECT:
+			// `CONNECT <user>@<host>:<port> [WITH PASSWORD|FILE <value>]`
+			if len(words) > 4 && upper(words, 2, KeywordWITH) {
+				for _, connectType := range host.ConnectTypes {
+					if upper(words, 3, connectType) {
+						break
+					}
+				}
+			}
+		case ActionIF, ActionASSERT:
+			condition(words[1:])
+		case ActionELSE:
+			if upper(words, 1, ActionIF) {
+				condition(words[2:])
+			}
+		case ActionFOR:
+			upper(words, 2, KeywordIN)
+
+			if len(words) > 5 && words[3].val == "<=" {
+				upper(words, 4, ActionLOCAL)
+			}
+		case ActionTASK:
+			upper(words, 2, KeywordDEPENDS)
+		case ActionRUN, ActionTRY:
+			if len(words) > 2 {
+				upper(words, 1, ActionLOCAL)
+			}
+		case ActionVAR, ActionSECRET:
+			for i := 1; i < len(words) && i <= 2; i++ {
+				if strings.HasSuffix(words[i].val, "<=") {
+					if i+2 < len(words) {
+						upper(words, i+1, ActionLOCAL)
+					}
+					break
+				}
+			}
+		case ActionRETRY:
+			// `RETRY <times> [EVERY <interval>] [BACKOFF [factor]] [JITTER] <step>`
+			for i := 2; i < len(words); i++ {
+				switch {
+				case upper(words, i, KeywordEVERY):
+					i++
+				case upper(words, i, KeywordBACKOFF):
+					if i+1 < len(words) && isBackoffFactor(words[i+1].val) {
+						i++
+					}
+				case upper(words, i, KeywordJITTER):
+				default:
+					normalize(words[i:])
+					return
+				}
+			}
+		case ActionON:
+			upper(words, 1, KeywordFAILURE)
+		case ActionTIMEOUT:
+			// `TIMEOUT <duration> <step>`
+			normalize(words[2:])
+		case ActionWAIT:
+			// `WAIT FOR <target> <value> [STATUS <code>] [MATCHES <pattern>] [ON REMOTE|LOCAL] [EVERY <d>] [TIMEOUT <d>]`
+			if !upper(words, 1, ActionFOR) {
+				return
+			}
+
+			for _, target := range []string{KeywordPORT, KeywordHTTP, KeywordFILE, KeywordLOG} {
+				if upper(words, 2, target) {
+					break
+				}
+			}
+
+			for i := 4; i < len(words); i += 2 {
+				switch {
+				case upper(words, i, KeywordON):
+					if !upper(words, i+1, KeywordREMOTE) {
+						upper(words, i+1, ActionLOCAL)
+					}
+				case upper(words, i, KeywordSTATUS), upper(words, i, KeywordMATCHES), upper(words, i, KeywordEVERY), upper(words, i, KeywordTIMEOUT):
+				default:
+					return
+				}
+			}
+		}
+	}
+
+	for _, l := range splitStatements(lex(input)) {
+		normalize(l.words)
+	}
+
+	return string(b)
+}
@@ -0,0 +1,124 @@
+package grammar_test
+
+import (
+	"testing"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func TestFormat(t *testing.T) {
+	type args struct {
+		input string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "uppercase keywords",
+			args: args{
+				input: "connect root@192.168.0.1:22\nif not exists /srv\nrun ls\nelse if run local test -d /tmp\nend\nfor f in <= local ls\nend\ntask deploy depends build\nend\n",
+			},
+			want: "CONNECT root@192.168.0.1:22\nIF NOT EXISTS /srv\n  RUN ls\nELSE IF RUN LOCAL test -d /tmp\nEND\nFOR f IN <= LOCAL ls\nEND\nTASK deploy DEPENDS build\nEND\n",
+		},
+		{
+			name: "uppercase keywords of connect",
+			args: args{
+				input: "connect root@192.168.0.1:22 with password with file\nconnect root@192.168.0.2:22 With File ./id_rsa\n",
+			},
+			want: "CONNECT root@192.168.0.1:22 WITH PASSWORD with file\nCONNECT root@192.168.0.2:22 WITH FILE ./id_rsa\n",
+		},
+		{
+			name: "uppercase keywords of wrapped step",
+			args: args{
+				input: "retry 3 every 3s backoff 2 jitter run local test -d /tmp\nassert remote file /srv exists\n",
+			},
+			want: "RETRY 3 EVERY 3s BACKOFF 2 JITTER RUN LOCAL test -d /tmp\nASSERT REMOTE FILE /srv EXISTS\n",
+		},
+		{
+			name: "uppercase keywords of timeout",
+			args: args{
+				input: "timeout 5m retry 3 run ./deploy.sh\nwait for port 8080 on remote timeout 30s\n",
+			},
+			want: "TIMEOUT 5m RETRY 3 RUN ./deploy.sh\nWAIT FOR PORT 8080 ON REMOTE TIMEOUT 30s\n",
+		},
+		{
+			name: "words like keywords are kept",
+			args: args{
+				input: "IF run == not\nEND\nFOR in IN local exists\nEND\n",
+			},
+			want: "IF run == not\nEND\nFOR in IN local exists\nEND\n",
+		},
+		{
+			name: "spacing",
+			args: args{
+				input: "VAR  name=hello  world\nVAR version<=  node -v\nENV  GREETING   =  hi\nUPLOAD   ./dist    /srv   # upload\nDEFINE restart( service,port )\nEND\narg  TARGET=prod\n",
+			},
+			want: "VAR name = hello  world\nVAR version <= node -v\nENV GREETING = hi\nUPLOAD ./dist /srv # upload\nDEFINE restart(service, port)\nEND\nARG TARGET = prod\n",
+		},
+		{
+			name: "indentation and blank lines",
+			args: args{
+				input: "\n\n# comment\nTASK build\n\tIF a == b\n\t\t\t# nested\n    CD /srv\n\n\n\n\tEND\nEND\n\n",
+			},
+			want: "# comment\nTASK build\n  IF a == b\n    # nested\n    CD /srv\n\n  END\nEND\n",
+		},
+		{
+			name: "indentation of parallel",
+			args: args{
+				input: "parallel\nupload ./a /srv\n    run npm ci\nend\n",
+			},
+			want: "PARALLEL\n  UPLOAD ./a /srv\n  RUN npm ci\nEND\n",
+		},
+		{
+			name: "indentation of failure handlers",
+			args: args{
+				input: "on failure\nrun ln -sfn /srv/prev /srv/current\nend\nfinally\n    delete /srv/maintenance\nend\n",
+			},
+			want: "ON FAILURE\n  RUN ln -sfn /srv/prev /srv/current\nEND\nFINALLY\n  DELETE /srv/maintenance\nEND\n",
+		},
+		{
+			name: "line continuations",
+			args: args{
+				input: "RUN npm version \\\n  && npm run build \\\n        && npm test\nUPLOAD \\\n  a.txt b.txt \\\n  /srv",
+			},
+			want: "RUN npm version      \\\n    && npm run build \\\n    && npm test\nUPLOAD          \\\n    a.txt b.txt \\\n    /srv\n",
+		},
+		{
+			name: "heredoc is kept",
+			args: args{
+				input: "IF a == a\nrun <<EOF\n  echo  {{name}}\n\tEOF\nend",
+			},
+			want: "IF a == a\n  RUN <<EOF\n  echo  {{name}}\n\tEOF\nEND\n",
+		},
+		{
+			name: "invalid source",
+			args: args{
+				input: "RUN ls\nFOO bar",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grammar.Format(".s4", tt.args.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Format() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Format() = \n%v\nwant\n%v", got, tt.want)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			// format is idempotent
+			if again, err := grammar.Format(".s4", got); err != nil || again != got {
+				t.Errorf("Format() is not idempotent = \n%v\nwant\n%v", again, got)
+			}
+		})
+	}
+}
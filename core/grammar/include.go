@@ -0,0 +1,147 @@
+package grammar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ParseFile reads and parses the s4 file, or the YAML/JSON workflow by the extension. See ParseDocument.
+// The files of INCLUDE are parsed and spliced in, their paths are relative to the including file
+func ParseFile(file string) ([]Token, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &includeResolver{
+		stack: []string{abs},
+		names: []string{file},
+		lines: map[string][]string{},
+	}
+
+	tokens := r.parse(file, string(content))
+
+	return tokens, r.errors.Err()
+}
+
+type includeResolver struct {
+	stack  []string            // the absolute paths of the files being parsed, for cycle detection
+	names  []string            // the paths of the files being parsed, for error message
+	lines  map[string][]string // the lines of the parsed files, for error message
+	errors ErrorList
+}
+
+func (r *includeResolver) parse(file string, input string) []Token {
+	var (
+		tokens []Token
+		err    error
+	)
+
+	if IsDocument(file) {
+		tokens, err = ParseDocument(file, input)
+	} else {
+		tokens, err = Parse(file, input)
+	}
+
+	if list, ok := err.(ErrorList); ok {
+		r.errors = append(r.errors, list...)
+	}
+
+	r.lines[file] = splitLines(input)
+
+	return r.resolve(file, r.lines[file], tokens)
+}
+
+// resolve walks through the tokens, including the tokens in blocks, and parses the included files
+func (r *includeResolver) resolve(file string, lines []string, tokens []Token) []Token {
+	for i, token := range tokens {
+		switch node := token.Node.(type) {
+		case NodeInclude:
+			tokens[i].Node = r.include(file, lines, node)
+		case NodeIf:
+			node.Then = r.resolve(file, lines, node.Then)
+			node.Else = r.resolve(file, lines, node.Else)
+			tokens[i].Node = node
+		case NodeFor:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+		case NodeTask:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+		case NodeDefine:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+		case NodeParallel:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+
+			// the steps of this file have been checked by parser
+			walkParallel(node.Body, func(token Token, f string) {
+				if f != "" {
+					r.errors = append(r.errors, newError(f, r.lines[f], token.Node.(Locatable).Location(), parallelStateMsg(token)))
+				}
+			})
+		case NodeOnFailure:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+		case NodeFinally:
+			node.Body = r.resolve(file, lines, node.Body)
+			tokens[i].Node = node
+		}
+	}
+
+	return tokens
+}
+
+func (r *includeResolver) include(file string, lines []string, node NodeInclude) NodeInclude {
+	target := node.Path
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(file), target)
+	}
+
+	node.File = target
+
+	abs, err := filepath.Abs(target)
+
+	if err != nil {
+		r.errors = append(r.errors, newError(file, lines, node.Span, err.Error()))
+		return node
+	}
+
+	for i, f := range r.stack {
+		if f == abs {
+			chain := append(append([]string{}, r.names[i:]...), target)
+			msg := fmt.Sprintf("circular `%s` of `%s`", ActionINCLUDE, strings.Join(chain, "` -> `"))
+			r.errors = append(r.errors, newError(file, lines, node.Span, msg))
+			return node
+		}
+	}
+
+	content, err := ioutil.ReadFile(target)
+
+	if err != nil {
+		msg := fmt.Sprintf("can not include `%s`: %s", node.Path, err)
+		r.errors = append(r.errors, newError(file, lines, node.Span, msg))
+		return node
+	}
+
+	r.stack = append(r.stack, abs)
+	r.names = append(r.names, target)
+
+	node.Body = r.parse(target, string(content))
+
+	r.stack = r.stack[:len(r.stack)-1]
+	r.names = r.names[:len(r.names)-1]
+
+	return node
+}
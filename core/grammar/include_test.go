@@ -0,0 +1,131 @@
+package grammar_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		".s4":                     "INCLUDE ./common/setup.s4\nRUN ls",
+		"common/setup.s4":         "IF a == a\n  INCLUDE nginx/restart.s4\nEND",
+		"common/nginx/restart.s4": "RUN nginx -s reload",
+	})
+
+	tokens, err := grammar.ParseFile(filepath.Join(dir, ".s4"))
+
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	include := tokens[0].Node.(grammar.NodeInclude)
+
+	if include.File != filepath.Join(dir, "common/setup.s4") {
+		t.Errorf("ParseFile() included file = %s", include.File)
+	}
+
+	nested := include.Body[0].Node.(grammar.NodeIf).Then[0].Node.(grammar.NodeInclude)
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionRUN,
+			Node: grammar.NodeRun{
+				Commands: []grammar.NodeRunCommand{
+					{Command: []string{"nginx -s reload"}, SourceCode: "nginx -s reload"},
+				},
+				SourceCode:      "nginx -s reload",
+				ExitWithCommand: true,
+				Span:            span(1, 1, 1, 20),
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(nested.Body, want) {
+		t.Errorf("ParseFile() nested include = %+v, want %+v", nested.Body, want)
+	}
+}
+
+func TestParseFileIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "circular include",
+			files: map[string]string{
+				".s4":    "INCLUDE a.s4",
+				"a.s4":   "INCLUDE b/b.s4",
+				"b/b.s4": "INCLUDE ../a.s4",
+			},
+			want: []string{"b.s4:1:1: circular `INCLUDE`"},
+		},
+		{
+			name: "error in included file",
+			files: map[string]string{
+				".s4":  "INCLUDE a.s4\nFOO",
+				"a.s4": "RUN ls\nCD a b",
+			},
+			want: []string{".s4:2:1: invalid keyword `FOO`", "a.s4:2:4: `CD` only accepts one string"},
+		},
+		{
+			name: "state changed by included file in parallel",
+			files: map[string]string{
+				".s4":  "PARALLEL\n  INCLUDE a.s4\n  RUN ls\nEND",
+				"a.s4": "RUN ls\nIF a == a\n  CD /srv\nEND",
+			},
+			want: []string{"a.s4:3:3: `CD` can not run in `PARALLEL`"},
+		},
+		{
+			name: "included file not found",
+			files: map[string]string{
+				".s4": "RUN ls\nINCLUDE not_found.s4",
+			},
+			want: []string{".s4:2:1: can not include `not_found.s4`"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+
+			_, err := grammar.ParseFile(filepath.Join(dir, ".s4"))
+
+			var list grammar.ErrorList
+
+			if !errors.As(err, &list) || len(list) != len(tt.want) {
+				t.Fatalf("ParseFile() error = %v, want %d errors", err, len(tt.want))
+			}
+
+			for i, e := range list {
+				if !strings.Contains(e.Error(), tt.want[i]) {
+					t.Errorf("ParseFile() error = %v, want %s", e, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// heredocReg matches the start of heredoc. eg. <<EOF, <<'EOF' or <<"EOF"
+var heredocReg = regexp.MustCompile(`^<<(?:'(\w+)'|"(\w+)"|(\w+))(?:[ \t\r\n]|$)`)
+
+type itemType int
+
+const (
+	itemEOF     itemType = iota
+	itemNewline          // end of a statement
+	itemWord             // a run of non-blank characters, may contain quoted strings
+	itemComment          // from `#` to the end of line
+	itemHeredoc          // the lines of heredoc, the value is the body without the delimiter line
+	itemError            // the value is the error message
+)
+
+// item is a lexeme of the source
+type item struct {
+	typ    itemType
+	val    string // for word, the quotes are removed and the escape sequences are resolved
+	span   Span
+	offset int // byte offset of the start in the source
+	end    int // byte offset of the end in the source
+}
+
+// lexer splits the source into items. Line continuations (a backslash at the end of line) are swallowed,
+// so the statement continues on the next line
+type lexer struct {
+	input  string
+	offset int
+	line   int
+	column int
+	items  []item
+
+	heredoc       string // the delimiter of heredoc which starts in the current line
+	heredocMarker item   // the start of heredoc. eg. <<EOF
+}
+
+func lex(input string) []item {
+	l := &lexer{
+		input:  input,
+		line:   1,
+		column: 1,
+	}
+
+	l.run()
+
+	return l.items
+}
+
+func (l *lexer) position() Position {
+	return Position{Line: l.line, Column: l.column}
+}
+
+func (l *lexer) peek() rune {
+	if l.offset >= len(l.input) {
+		return utf8.RuneError
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.offset:])
+	return r
+}
+
+func (l *lexer) next() rune {
+	if l.offset >= len(l.input) {
+		return utf8.RuneError
+	}
+
+	r, size := utf8.DecodeRuneInString(l.input[l.offset:])
+
+	l.offset += size
+
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
+	return r
+}
+
+func (l *lexer) emit(typ itemType, start Position, startOffset int) {
+	l.emitValue(typ, l.input[startOffset:l.offset], start, startOffset)
+}
+
+func (l *lexer) emitValue(typ itemType, val string, start Position, startOffset int) {
+	l.items = append(l.items, item{
+		typ:    typ,
+		val:    val,
+		span:   Span{Start: start, End: l.position()},
+		offset: startOffset,
+		end:    l.offset,
+	})
+}
+
+func (l *lexer) eof() bool {
+	return l.offset >= len(l.input)
+}
+
+// isContinuation reports whether a backslash at the current offset is followed by the end of line
+func (l *lexer) isContinuation() bool {
+	if l.peek() != '\\' {
+		return false
+	}
+
+	rest := strings.TrimLeft(l.input[l.offset+1:], " \t\r")
+
+	return strings.HasPrefix(rest, "\n") || rest == ""
+}
+
+// skipContinuation skips the backslash and the line break after it
+func (l *lexer) skipContinuation() {
+	for !l.eof() {
+		if l.next() == '\n' {
+			return
+		}
+	}
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r'
+}
+
+func (l *lexer) run() {
+	for !l.eof() {
+		r := l.peek()
+
+		switch {
+		case isBlank(r):
+			l.next()
+		case r == '\n':
+			start, startOffset := l.position(), l.offset
+			l.next()
+
+			if l.heredoc != "" {
+				// the statement ends after the heredoc, including the line break of the delimiter line
+				l.lexHeredoc()
+				if l.peek() == '\n' {
+					l.next()
+				}
+				l.emitValue(itemNewline, "\n", start, startOffset)
+			} else {
+				l.emit(itemNewline, start, startOffset)
+			}
+		case l.isContinuation():
+			l.skipContinuation()
+		case r == '#':
+			l.lexComment()
+		case l.heredoc == "" && heredocReg.MatchString(l.input[l.offset:]):
+			l.lexHeredocStart()
+		default:
+			l.lexWord()
+		}
+	}
+
+	if l.heredoc != "" {
+		l.lexHeredoc()
+	}
+
+	l.emit(itemEOF, l.position(), l.offset)
+}
+
+func (l *lexer) lexComment() {
+	start, startOffset := l.position(), l.offset
+
+	for !l.eof() && l.peek() != '\n' {
+		l.next()
+	}
+
+	// do not include the carriage return of CRLF
+	for l.offset > startOffset && l.input[l.offset-1] == '\r' {
+		l.offset--
+		l.column--
+	}
+
+	l.emit(itemComment, start, startOffset)
+
+	for !l.eof() && l.peek() == '\r' {
+		l.next()
+	}
+}
+
+// lexWord reads a word like the shell does. eg. `"my file.txt"`, `'/opt/My App'` or `my\ file.txt`
+func (l *lexer) lexWord() {
+	start, startOffset := l.position(), l.offset
+
+	var value strings.Builder
+
+	for !l.eof() {
+		r := l.peek()
+
+		if isBlank(r) || r == '\n' || l.isContinuation() {
+			break
+		}
+
+		if n := l.templateLength(); n > 0 {
+			// the template is kept as it is, so it can contain blanks and quotes. eg. {{ name | default "x" }}
+			end := l.offset + n
+			for l.offset < end {
+				value.WriteRune(l.next())
+			}
+			continue
+		}
+
+		switch r {
+		case '"', '\'':
+			if err := l.lexQuoted(&value); err != "" {
+				l.emitValue(itemError, err, start, startOffset)
+				return
+			}
+		case '\\':
+			l.next()
+
+			// outside of quotes, backslash only escapes the characters which have special meaning
+			switch next := l.peek(); next {
+			case ' ', '\t', '"', '\'', '#', '\\':
+				value.WriteRune(l.next())
+			default:
+				value.WriteRune(r)
+			}
+		default:
+			value.WriteRune(l.next())
+		}
+	}
+
+	l.emitValue(itemWord, value.String(), start, startOffset)
+}
+
+// templateLength returns the length of the template at the current offset, or 0 if there is no template in the line
+func (l *lexer) templateLength() int {
+	rest := l.input[l.offset:]
+
+	if !strings.HasPrefix(rest, "{{") {
+		return 0
+	}
+
+	var quote byte
+
+	for i := 2; i < len(rest) && rest[i] != '\n'; i++ {
+		switch {
+		case quote != 0:
+			if rest[i] == '\\' && quote == '"' {
+				i++
+			} else if rest[i] == quote {
+				quote = 0
+			}
+		case rest[i] == '"' || rest[i] == '\'':
+			quote = rest[i]
+		case strings.HasPrefix(rest[i:], "}}"):
+			return i + 2
+		}
+	}
+
+	return 0
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// lexQuoted reads a quoted string and writes the unquoted value.
+// It returns an error message if the string is not terminated
+func (l *lexer) lexQuoted(value *strings.Builder) string {
+	quote := l.next()
+
+	for {
+		if l.eof() || l.peek() == '\n' {
+			return fmt.Sprintf("unterminated quoted string, missing %c", quote)
+		}
+
+		r := l.next()
+
+		switch r {
+		case quote:
+			return ""
+		case '\\':
+			// unknown escape sequence is kept as it is. eg. "C:\dir"
+			if e, ok := escapes[l.peek()]; ok && !l.eof() {
+				l.next()
+				value.WriteRune(e)
+			} else {
+				value.WriteRune(r)
+			}
+		default:
+			value.WriteRune(r)
+		}
+	}
+}
+
+// lexHeredocStart reads the start of heredoc as a word, the body is read at the end of line
+func (l *lexer) lexHeredocStart() {
+	start, startOffset := l.position(), l.offset
+
+	m := heredocReg.FindStringSubmatch(l.input[l.offset:])
+
+	l.heredoc = m[1] + m[2] + m[3]
+
+	for !l.eof() && !isBlank(l.peek()) && l.peek() != '\n' {
+		l.next()
+	}
+
+	l.emit(itemWord, start, startOffset)
+
+	l.heredocMarker = l.items[len(l.items)-1]
+}
+
+// lexHeredoc reads the lines until the delimiter line. The lines are kept verbatim
+func (l *lexer) lexHeredoc() {
+	delimiter := l.heredoc
+	l.heredoc = ""
+
+	start, startOffset := l.position(), l.offset
+
+	var body strings.Builder
+
+	for !l.eof() {
+		lineStart := l.offset
+
+		for !l.eof() && l.peek() != '\n' {
+			l.next()
+		}
+
+		line := l.input[lineStart:l.offset]
+
+		// the delimiter line can be indented like the other statements in block
+		if strings.TrimSpace(line) == delimiter {
+			l.emitValue(itemHeredoc, body.String(), start, startOffset)
+			return
+		}
+
+		body.WriteString(line)
+
+		if !l.eof() {
+			body.WriteRune(l.next())
+		}
+	}
+
+	marker := l.heredocMarker
+	marker.typ = itemError
+	marker.val = fmt.Sprintf("unterminated heredoc, missing `%s`", delimiter)
+
+	l.items = append(l.items, marker)
+}
@@ -0,0 +1,155 @@
+package grammar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FindMacros collects the macros defined at the top level, including the top level of the included files.
+// It also verifies that all the CALLs refer to defined macros with the right number of arguments, and no macro calls itself.
+// The root is the file of tokens, it locates the errors
+func FindMacros(root string, tokens []Token) (map[string]NodeDefine, error) {
+	macros := map[string]NodeDefine{}
+	defined := map[string]string{} // where the macro is defined
+	files := map[string]string{}   // the file where the macro is defined
+
+	var err error
+
+	Walk(tokens, func(token Token, file string) bool {
+		if file == "" {
+			file = root
+		}
+
+		switch node := token.Node.(type) {
+		case NodeDefine:
+			if exist, ok := defined[node.Name]; ok && err == nil {
+				err = fmt.Errorf("macro `%s` at %s has been defined at %s", node.Name, location(file, node.Start), exist)
+			}
+
+			defined[node.Name] = location(file, node.Start)
+			files[node.Name] = file
+			macros[node.Name] = node
+		case NodeInclude:
+			return true
+		}
+
+		// only the top level
+		return false
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	Walk(tokens, func(token Token, file string) bool {
+		if file == "" {
+			file = root
+		}
+
+		if node, ok := token.Node.(NodeCall); ok && err == nil {
+			macro, ok := macros[node.Name]
+
+			if !ok {
+				err = fmt.Errorf("%s: `%s` undefined macro `%s`", location(file, node.Start), ActionCALL, node.Name)
+			} else if len(node.Args) != len(macro.Params) {
+				err = fmt.Errorf("%s: macro `%s` expect %d arguments but got %d", location(file, node.Start), node.Name, len(macro.Params), len(node.Args))
+			}
+		}
+
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRecursion(macros, files); err != nil {
+		return nil, err
+	}
+
+	return macros, nil
+}
+
+// macroCall is a CALL in the body of macro
+type macroCall struct {
+	name     string // the called macro
+	location string // where the CALL is. eg. common.s4:3:2
+}
+
+// checkRecursion reports the macro which calls itself, directly or through other macros, it never ends.
+// eg. circular `CALL` of macro `a` (deploy.s4:3:2) -> `b` (deploy.s4:6:2) -> `a`, the location is where the macro calls the next one
+func checkRecursion(macros map[string]NodeDefine, files map[string]string) error {
+	calls := map[string][]macroCall{}
+	names := make([]string, 0, len(macros))
+
+	for name, macro := range macros {
+		names = append(names, name)
+
+		Walk(macro.Body, func(token Token, file string) bool {
+			if file == "" {
+				file = files[name]
+			}
+
+			if node, ok := token.Node.(NodeCall); ok {
+				calls[name] = append(calls[name], macroCall{name: node.Name, location: location(file, node.Start)})
+			}
+
+			return true
+		})
+	}
+
+	// the order of map is random, the error is the same in every run
+	sort.Strings(names)
+
+	var (
+		visited = map[string]bool{}
+		stack   []string // the macros being visited
+		via     []string // via[i] is where stack[i] calls stack[i+1]
+	)
+
+	var visit func(name string) error
+
+	visit = func(name string) error {
+		for i, n := range stack {
+			if n == name {
+				var chain []string
+
+				for j := i; j < len(stack); j++ {
+					chain = append(chain, fmt.Sprintf("`%s` (%s)", stack[j], via[j]))
+				}
+
+				return fmt.Errorf("circular `%s` of macro %s -> `%s`", ActionCALL, strings.Join(chain, " -> "), name)
+			}
+		}
+
+		if visited[name] {
+			return nil
+		}
+
+		stack = append(stack, name)
+
+		for _, call := range calls[name] {
+			via = append(via, call.location)
+
+			if err := visit(call.name); err != nil {
+				return err
+			}
+
+			via = via[:len(via)-1]
+		}
+
+		stack = stack[:len(stack)-1]
+		visited[name] = true
+
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
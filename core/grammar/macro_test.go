@@ -0,0 +1,142 @@
+package grammar_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func TestParseDefine(t *testing.T) {
+	input := `DEFINE restart(service, port)
+	RUN systemctl restart {{service}}
+END
+CALL restart nginx 80`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionDEFINE,
+			Node: grammar.NodeDefine{
+				Name:   "restart",
+				Params: []string{"service", "port"},
+				Body: []grammar.Token{
+					{
+						Key: grammar.ActionRUN,
+						Node: grammar.NodeRun{
+							Commands: []grammar.NodeRunCommand{
+								{Command: []string{"systemctl restart {{service}}"}, SourceCode: "systemctl restart {{service}}"},
+							},
+							SourceCode:      "systemctl restart {{service}}",
+							ExitWithCommand: true,
+							Span:            span(2, 2, 2, 35),
+						},
+					},
+				},
+				SourceCode: "restart(service, port)",
+				Span:       span(1, 1, 3, 4),
+			},
+		},
+		{
+			Key: grammar.ActionCALL,
+			Node: grammar.NodeCall{
+				Name:       "restart",
+				Args:       []string{"nginx", "80"},
+				SourceCode: "restart nginx 80",
+				Span:       span(4, 1, 4, 22),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFindMacros(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:  "basic",
+			input: "DEFINE a\nEND\nDEFINE b(x)\nEND\nIF 1 == 1\n\tCALL b {{x}}\nEND\nCALL a",
+			want:  []string{"a", "b"},
+		},
+		{
+			name:    "duplicate macro",
+			input:   "DEFINE a\nEND\nDEFINE a(x)\nEND",
+			wantErr: true,
+		},
+		{
+			name:    "undefined macro",
+			input:   "TASK deploy\n\tCALL a\nEND",
+			wantErr: true,
+		},
+		{
+			name:    "wrong number of arguments",
+			input:   "DEFINE a(x, y)\nEND\nCALL a 1",
+			wantErr: true,
+		},
+		{
+			name:    "recursive macro",
+			input:   "DEFINE loop\n\tCALL loop\nEND\nCALL loop",
+			wantErr: true,
+			errMsg:  "circular `CALL` of macro `loop` (.s4:2:2) -> `loop`",
+		},
+		{
+			name:    "mutually recursive macros",
+			input:   "DEFINE a\n\tCALL b\nEND\nDEFINE b\n\tIF 1 == 1\n\t\tCALL a\n\tEND\nEND\nCALL a",
+			wantErr: true,
+			errMsg:  "circular `CALL` of macro `a` (.s4:2:2) -> `b` (.s4:6:3) -> `a`",
+		},
+		{
+			name:    "nested define",
+			input:   "TASK deploy\n\tDEFINE a\n\tEND\nEND",
+			wantErr: true,
+		},
+		{
+			name:    "invalid parameter",
+			input:   "DEFINE a(1-x)\nEND",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := grammar.Parse(".s4", tt.input)
+
+			var macros map[string]grammar.NodeDefine
+
+			if err == nil {
+				macros, err = grammar.FindMacros(".s4", tokens)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindMacros() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.errMsg != "" && err.Error() != tt.errMsg {
+				t.Errorf("FindMacros() error = %v, want %v", err, tt.errMsg)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			for _, name := range tt.want {
+				if _, ok := macros[name]; !ok {
+					t.Errorf("FindMacros() missing macro `%s`", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1206 @@
+package grammar
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axetroy/s4/core/host"
+	"github.com/axetroy/s4/core/variable"
+)
+
+const (
+	defaultRetryInterval = time.Second
+	defaultRetryBackoff  = 2
+	defaultWaitInterval  = time.Second
+	defaultWaitTimeout   = time.Minute
+)
+
+var (
+	envKeyReg   = regexp.MustCompile(`^\w+$`)
+	taskNameReg = regexp.MustCompile(`^[\w.-]+$`)
+	defineReg   = regexp.MustCompile(`^([\w.-]+)\s*(?:\(([\w\s,]*)\))?$`)
+	argReg      = regexp.MustCompile(`^(\w+)(\s*=\s*(.*))?$`)
+)
+
+// statement is a keyword with its arguments. It ends at the end of line
+type statement struct {
+	keyword item
+	args    []item
+	heredoc *item // the body of heredoc if the statement has
+	broken  bool  // there are lexical errors in the statement
+}
+
+// span covers the keyword and all the arguments, including the heredoc
+func (s statement) span() Span {
+	if s.heredoc != nil {
+		return Span{Start: s.keyword.span.Start, End: s.heredoc.span.End}
+	}
+	if len(s.args) == 0 {
+		return s.keyword.span
+	}
+	return Span{Start: s.keyword.span.Start, End: s.args[len(s.args)-1].span.End}
+}
+
+// argsSpan covers all the arguments
+func (s statement) argsSpan() Span {
+	if len(s.args) == 0 {
+		return s.keyword.span
+	}
+	return Span{Start: s.args[0].span.Start, End: s.args[len(s.args)-1].span.End}
+}
+
+func (s statement) values() []string {
+	values := make([]string, 0, len(s.args))
+
+	for _, arg := range s.args {
+		values = append(values, arg.val)
+	}
+
+	return values
+}
+
+// raw returns the arguments as they are written in the source.
+// The arguments which are continued on the next line are joined with a space
+func (s statement) raw(input string) string {
+	var segments []string
+
+	for i := 0; i < len(s.args); {
+		j := i
+		for j+1 < len(s.args) && s.args[j+1].span.Start.Line == s.args[i].span.Start.Line {
+			j++
+		}
+		segments = append(segments, input[s.args[i].offset:s.args[j].end])
+		i = j + 1
+	}
+
+	return strings.Join(segments, spaceBlank)
+}
+
+type parser struct {
+	file   string
+	input  string
+	lines  []string
+	items  []item
+	pos    int
+	depth  int // the depth of nested blocks, the top level is 1
+	errors ErrorList
+}
+
+// Parse parses the s4 source. All the syntax errors are collected and returned as an ErrorList
+func Parse(file string, input string) ([]Token, error) {
+	p := &parser{
+		file:  file,
+		input: input,
+		lines: splitLines(input),
+		items: lex(input),
+	}
+
+	// without terminators, it only stops at the end of file
+	tokens, _, _ := p.parseBlock()
+
+	return tokens, p.errors.Err()
+}
+
+func (p *parser) errorf(span Span, format string, a ...interface{}) *Error {
+	return newError(p.file, p.lines, span, fmt.Sprintf(format, a...))
+}
+
+func splitLines(input string) []string {
+	return strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n")
+}
+
+func newError(file string, lines []string, span Span, msg string) *Error {
+	e := &Error{
+		File: file,
+		Span: span,
+		Msg:  msg,
+	}
+
+	if line := span.Start.Line; line > 0 && line <= len(lines) {
+		e.Source = lines[line-1]
+	}
+
+	return e
+}
+
+// nextStatement skips the blank lines and comments, then collects the items until the end of line
+func (p *parser) nextStatement() (statement, bool) {
+	var stmt statement
+
+	for {
+		it := p.items[p.pos]
+
+		switch it.typ {
+		case itemEOF:
+			return stmt, false
+		case itemNewline, itemComment:
+			p.pos++
+			continue
+		}
+
+		break
+	}
+
+	stmt.keyword = p.items[p.pos]
+	p.pos++
+
+	if stmt.keyword.typ == itemError {
+		p.errors = append(p.errors, p.errorf(stmt.keyword.span, "%s", stmt.keyword.val))
+		stmt.broken = true
+	}
+
+	for {
+		it := p.items[p.pos]
+
+		if it.typ == itemEOF {
+			break
+		}
+
+		p.pos++
+
+		if it.typ == itemNewline {
+			break
+		}
+
+		switch it.typ {
+		case itemWord:
+			stmt.args = append(stmt.args, it)
+		case itemHeredoc:
+			heredoc := it
+			stmt.heredoc = &heredoc
+		case itemError:
+			p.errors = append(p.errors, p.errorf(it.span, "%s", it.val))
+			stmt.broken = true
+		}
+	}
+
+	return stmt, true
+}
+
+// parseBlock parses the statements until one of the terminators.
+// It returns the terminator statement, or false if it reaches the end of file
+func (p *parser) parseBlock(terminators ...string) ([]Token, statement, bool) {
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+
+	tokens := make([]Token, 0)
+
+	for {
+		stmt, ok := p.nextStatement()
+
+		if !ok {
+			return tokens, stmt, false
+		}
+
+		keyword := stmt.keyword.val
+
+		for _, terminator := range terminators {
+			if keyword == terminator {
+				return tokens, stmt, true
+			}
+		}
+
+		var (
+			token Token
+			err   *Error
+		)
+
+		if stmt.heredoc != nil && keyword != ActionRUN && keyword != ActionTRY && keyword != ActionLOCAL {
+			p.errors = append(p.errors, p.errorf(stmt.keyword.span, "`%s` does not accept heredoc", keyword))
+			stmt.broken = true
+		}
+
+		switch keyword {
+		case ActionIF:
+			token, err = p.parseIf(stmt)
+		case ActionFOR:
+			token, err = p.parseFor(stmt)
+		case ActionTASK:
+			token, err = p.parseTask(stmt)
+		case ActionDEFINE:
+			token, err = p.parseDefine(stmt)
+		case ActionPARALLEL:
+			token, err = p.parseParallel(stmt)
+		case ActionON:
+			token, err = p.parseOnFailure(stmt)
+		case ActionFINALLY:
+			token, err = p.parseFinally(stmt)
+		case ActionELSE, ActionEND:
+			err = p.errorf(stmt.keyword.span, "unexpected `%s`", keyword)
+		default:
+			if stmt.broken {
+				continue
+			}
+			token, err = p.parseStatement(stmt)
+		}
+
+		if err != nil {
+			p.errors = append(p.errors, err)
+			continue
+		}
+
+		tokens = append(tokens, token)
+	}
+}
+
+// parseIf parses `IF <condition> ... [ELSE [IF <condition>] ...] END`
+func (p *parser) parseIf(stmt statement) (Token, *Error) {
+	var (
+		condition NodeCondition
+		condErr   *Error
+	)
+
+	if !stmt.broken {
+		condition, condErr = p.parseCondition(stmt)
+	}
+
+	node := NodeIf{
+		Condition:  condition,
+		SourceCode: stmt.raw(p.input),
+	}
+
+	then, end, ok := p.parseBlock(ActionELSE, ActionEND)
+
+	if !ok {
+		return Token{}, p.errorf(stmt.keyword.span, "missing `%s` for `%s`", ActionEND, ActionIF)
+	}
+
+	node.Then = then
+
+	if end.keyword.val == ActionELSE {
+		if len(end.args) > 0 && end.args[0].val == ActionIF {
+			// ELSE IF <condition>, the nested IF consumes the END
+			elseIf, err := p.parseIf(statement{keyword: end.args[0], args: end.args[1:], broken: end.broken})
+
+			if err != nil {
+				return Token{}, err
+			}
+
+			node.Else = []Token{elseIf}
+			node.Span = Span{Start: stmt.keyword.span.Start, End: elseIf.Node.(NodeIf).End}
+
+			if condErr != nil {
+				return Token{}, condErr
+			}
+
+			return Token{Key: ActionIF, Node: node}, nil
+		}
+
+		if len(end.args) > 0 {
+			p.errors = append(p.errors, p.errorf(end.argsSpan(), "`%s` does not accept arguments", ActionELSE))
+		}
+
+		if node.Else, end, ok = p.parseBlock(ActionEND); !ok {
+			return Token{}, p.errorf(stmt.keyword.span, "missing `%s` for `%s`", ActionEND, ActionIF)
+		}
+	}
+
+	if len(end.args) > 0 {
+		p.errors = append(p.errors, p.errorf(end.argsSpan(), "`%s` does not accept arguments", ActionEND))
+	}
+
+	node.Span = Span{Start: stmt.keyword.span.Start, End: end.span().End}
+
+	if condErr != nil {
+		return Token{}, condErr
+	}
+
+	return Token{Key: ActionIF, Node: node}, nil
+}
+
+// parseFor parses `FOR <key> IN <item>... END` or `FOR <key> IN <= <command> END`
+func (p *parser) parseFor(stmt statement) (Token, *Error) {
+	node := NodeFor{
+		SourceCode: stmt.raw(p.input),
+	}
+
+	var headErr *Error
+
+	if !stmt.broken {
+		headErr = p.parseForHead(stmt, &node)
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	node.Body = body
+	node.Span = Span{Start: stmt.keyword.span.Start, End: end}
+
+	if headErr != nil {
+		return Token{}, headErr
+	}
+
+	return Token{Key: ActionFOR, Node: node}, nil
+}
+
+// parseBody parses the statements until `END`, for the blocks which have no `ELSE`.
+// It returns the end position of `END`
+func (p *parser) parseBody(stmt statement) ([]Token, Position, *Error) {
+	body, end, ok := p.parseBlock(ActionEND)
+
+	if !ok {
+		return nil, Position{}, p.errorf(stmt.keyword.span, "missing `%s` for `%s`", ActionEND, stmt.keyword.val)
+	}
+
+	if len(end.args) > 0 {
+		p.errors = append(p.errors, p.errorf(end.argsSpan(), "`%s` does not accept arguments", ActionEND))
+	}
+
+	return body, end.span().End, nil
+}
+
+// parseParallel parses `PARALLEL ... END`. The steps which change the state of workflow are not allowed,
+// because the steps after them may run before them
+func (p *parser) parseParallel(stmt statement) (Token, *Error) {
+	if len(stmt.args) > 0 {
+		p.errors = append(p.errors, p.errorf(stmt.argsSpan(), "`%s` does not accept arguments", ActionPARALLEL))
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	node := NodeParallel{
+		Body:       body,
+		SourceCode: stmt.raw(p.input),
+		Span:       Span{Start: stmt.keyword.span.Start, End: end},
+	}
+
+	walkParallel(body, func(token Token, file string) {
+		p.errors = append(p.errors, p.errorf(token.Node.(Locatable).Location(), "%s", parallelStateMsg(token)))
+	})
+
+	return Token{Key: ActionPARALLEL, Node: node}, nil
+}
+
+// walkParallel calls fn with the steps in the body of PARALLEL which change the state of the steps after it,
+// including the steps in the nested blocks and the included files. The nested PARALLEL has been checked by itself
+func walkParallel(body []Token, fn func(token Token, file string)) {
+	Walk(body, func(token Token, file string) bool {
+		switch token.Key {
+		case ActionCONNECT, ActionCD, ActionENV, ActionENVFILE, ActionVARFILE, ActionVAR, ActionSECRET:
+			fn(token, file)
+		case ActionPARALLEL:
+			return false
+		}
+
+		return true
+	})
+}
+
+func parallelStateMsg(token Token) string {
+	return fmt.Sprintf("`%s` can not run in `%s`, it changes the state of the steps after it", token.Key, ActionPARALLEL)
+}
+
+// parseOnFailure parses `ON FAILURE ... END`. It is only allowed at the top level
+func (p *parser) parseOnFailure(stmt statement) (Token, *Error) {
+	var headErr *Error
+
+	if p.depth > 1 {
+		headErr = p.errorf(stmt.keyword.span, "`%s %s` is only allowed at the top level", ActionON, KeywordFAILURE)
+	} else if !stmt.broken && (len(stmt.args) != 1 || stmt.args[0].val != KeywordFAILURE) {
+		headErr = p.errorf(stmt.argsSpan(), "`%s` need to match `%s` format but got `%s`", ActionON, KeywordFAILURE, stmt.raw(p.input))
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	if headErr != nil {
+		return Token{}, headErr
+	}
+
+	node := NodeOnFailure{
+		Body:       body,
+		SourceCode: stmt.raw(p.input),
+		Span:       Span{Start: stmt.keyword.span.Start, End: end},
+	}
+
+	return Token{Key: ActionON, Node: node}, nil
+}
+
+// parseFinally parses `FINALLY ... END`. It is only allowed at the top level
+func (p *parser) parseFinally(stmt statement) (Token, *Error) {
+	var headErr *Error
+
+	if p.depth > 1 {
+		headErr = p.errorf(stmt.keyword.span, "`%s` is only allowed at the top level", ActionFINALLY)
+	} else if len(stmt.args) > 0 {
+		p.errors = append(p.errors, p.errorf(stmt.argsSpan(), "`%s` does not accept arguments", ActionFINALLY))
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	if headErr != nil {
+		return Token{}, headErr
+	}
+
+	node := NodeFinally{
+		Body:       body,
+		SourceCode: stmt.raw(p.input),
+		Span:       Span{Start: stmt.keyword.span.Start, End: end},
+	}
+
+	return Token{Key: ActionFINALLY, Node: node}, nil
+}
+
+// parseTask parses `TASK <name> [DEPENDS <task>...] ... END`. It is only allowed at the top level
+func (p *parser) parseTask(stmt statement) (Token, *Error) {
+	node := NodeTask{
+		SourceCode: stmt.raw(p.input),
+	}
+
+	var headErr *Error
+
+	if p.depth > 1 {
+		headErr = p.errorf(stmt.keyword.span, "`%s` is only allowed at the top level", ActionTASK)
+	} else if !stmt.broken {
+		args := stmt.args
+
+		if len(args) == 0 || !taskNameReg.MatchString(args[0].val) || (len(args) > 1 && args[1].val != KeywordDEPENDS) || len(args) == 2 {
+			headErr = p.errorf(stmt.argsSpan(), "`%s` need to match `<name> [%s <task>...]` format but got `%s`", ActionTASK, KeywordDEPENDS, stmt.raw(p.input))
+		} else {
+			node.Name = args[0].val
+
+			if len(args) > 2 {
+				node.Depends = statement{args: args[2:]}.values()
+			}
+		}
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	node.Body = body
+	node.Span = Span{Start: stmt.keyword.span.Start, End: end}
+
+	if headErr != nil {
+		return Token{}, headErr
+	}
+
+	return Token{Key: ActionTASK, Node: node}, nil
+}
+
+func (p *parser) parseForHead(stmt statement, node *NodeFor) *Error {
+	args := stmt.args
+
+	if len(args) < 3 || args[1].val != KeywordIN || !envKeyReg.MatchString(args[0].val) {
+		return p.errorf(stmt.argsSpan(), "`%s` need to match `<key> %s <item>...` or `<key> %s <= <command>` format but got `%s`", ActionFOR, KeywordIN, KeywordIN, stmt.raw(p.input))
+	}
+
+	node.Key = args[0].val
+
+	if args[2].val != "<=" {
+		node.Items = statement{args: args[2:]}.values()
+		return nil
+	}
+
+	if len(args) < 4 {
+		return p.errorf(stmt.argsSpan(), "`%s` require a command after `<=`", ActionFOR)
+	}
+
+	cmd := statement{args: args[3:]}.raw(p.input)
+
+	// `<= LOCAL ls ./services` runs with the shell of local
+	if args[3].val == ActionLOCAL {
+		if len(args) < 5 {
+			return p.errorf(stmt.argsSpan(), "`%s` require a command", ActionLOCAL)
+		}
+
+		node.Command = &NodeVarCommand{Local: true, Shell: true, Command: []string{statement{args: args[4:]}.raw(p.input)}}
+	} else if strings.HasPrefix(cmd, "[") {
+		// if command defined as JSON array. eg ["ls", "./services"]. this should run in local
+		var command []string
+
+		if err := json.Unmarshal([]byte(cmd), &command); err != nil || len(command) == 0 {
+			return p.errorf(stmt.argsSpan(), "invalid JSON array format `%s`", cmd)
+		}
+
+		node.Command = &NodeVarCommand{Local: true, Command: command}
+	} else {
+		node.Command = &NodeVarCommand{Local: false, Command: strings.Split(cmd, " ")}
+	}
+
+	return nil
+}
+
+// parseRetry parses `RETRY <times> [EVERY <interval>] [BACKOFF [factor]] [JITTER] <step>`
+func (p *parser) parseRetry(stmt statement) (Token, *Error) {
+	args := stmt.args
+
+	node := NodeRetry{
+		Interval:   defaultRetryInterval,
+		Backoff:    1,
+		SourceCode: stmt.raw(p.input),
+		Span:       stmt.span(),
+	}
+
+	times, err := strconv.Atoi(args[0].val)
+
+	if err != nil || times < 1 {
+		return Token{}, p.errorf(args[0].span, "`%s` require the times of attempts but got `%s`", ActionRETRY, args[0].val)
+	}
+
+	node.Times = times
+
+	i := 1
+
+options:
+	for ; i < len(args); i++ {
+		switch args[i].val {
+		case KeywordEVERY:
+			if i+1 >= len(args) {
+				return Token{}, p.errorf(args[i].span, "`%s` require an interval. eg. `3s`", KeywordEVERY)
+			}
+
+			interval, err := time.ParseDuration(args[i+1].val)
+
+			if err != nil || interval < 0 {
+				return Token{}, p.errorf(args[i+1].span, "invalid interval `%s`, expect the duration like `3s` or `1m`", args[i+1].val)
+			}
+
+			node.Interval = interval
+			i++
+		case KeywordBACKOFF:
+			node.Backoff = defaultRetryBackoff
+
+			if i+1 < len(args) && isBackoffFactor(args[i+1].val) {
+				node.Backoff, _ = strconv.ParseFloat(args[i+1].val, 64)
+				i++
+
+				if node.Backoff < 1 {
+					return Token{}, p.errorf(args[i].span, "the factor of `%s` must not be less than 1 but got `%s`", KeywordBACKOFF, args[i].val)
+				}
+			}
+		case KeywordJITTER:
+			node.Jitter = true
+		default:
+			break options
+		}
+	}
+
+	token, e := p.parseWrappedStep(stmt, args[i:])
+
+	if e != nil {
+		return Token{}, e
+	}
+
+	node.Step = token
+
+	return Token{Key: ActionRETRY, Node: node}, nil
+}
+
+// parseTimeout parses `TIMEOUT <duration> <step>`
+func (p *parser) parseTimeout(stmt statement) (Token, *Error) {
+	args := stmt.args
+
+	timeout, err := time.ParseDuration(args[0].val)
+
+	if err != nil || timeout <= 0 {
+		return Token{}, p.errorf(args[0].span, "`%s` require a duration like `30s` or `5m` but got `%s`", ActionTIMEOUT, args[0].val)
+	}
+
+	token, e := p.parseWrappedStep(stmt, args[1:])
+
+	if e != nil {
+		return Token{}, e
+	}
+
+	return Token{
+		Key: ActionTIMEOUT,
+		Node: NodeTimeout{
+			Timeout:    timeout,
+			Step:       token,
+			SourceCode: stmt.raw(p.input),
+			Span:       stmt.span(),
+		},
+	}, nil
+}
+
+// parseWrappedStep parses the step wrapped by RETRY or TIMEOUT. eg. `RUN ./check.sh` of `RETRY 3 RUN ./check.sh`
+func (p *parser) parseWrappedStep(stmt statement, args []item) (Token, *Error) {
+	if len(args) == 0 {
+		return Token{}, p.errorf(stmt.span(), "`%s` require a step", stmt.keyword.val)
+	}
+
+	step := statement{keyword: args[0], args: args[1:], heredoc: stmt.heredoc}
+
+	switch step.keyword.val {
+	case ActionIF, ActionELSE, ActionEND, ActionFOR, ActionTASK, ActionDEFINE, ActionINCLUDE, ActionARG, ActionPARALLEL, ActionON, ActionFINALLY:
+		return Token{}, p.errorf(step.keyword.span, "`%s` can not be wrapped by `%s`", step.keyword.val, stmt.keyword.val)
+	}
+
+	return p.parseStatement(step)
+}
+
+// parseWait parses `WAIT FOR <target> <value> [STATUS <code>] [MATCHES <pattern>] [ON REMOTE|LOCAL] [EVERY <interval>] [TIMEOUT <duration>]`
+func (p *parser) parseWait(stmt statement) (Token, *Error) {
+	args := stmt.args
+	format := fmt.Sprintf("`%s %s <%s|%s|%s|%s> <value>`", ActionWAIT, ActionFOR, KeywordPORT, KeywordHTTP, KeywordFILE, KeywordLOG)
+
+	if len(args) < 3 || args[0].val != ActionFOR {
+		return Token{}, p.errorf(stmt.argsSpan(), "`%s` need to match %s format but got `%s`", ActionWAIT, format, stmt.raw(p.input))
+	}
+
+	node := NodeWait{
+		Target:     args[1].val,
+		Value:      args[2].val,
+		Interval:   defaultWaitInterval,
+		Timeout:    defaultWaitTimeout,
+		SourceCode: stmt.raw(p.input),
+		Span:       stmt.span(),
+	}
+
+	switch node.Target {
+	case KeywordPORT, KeywordHTTP:
+	case KeywordFILE, KeywordLOG:
+		node.Remote = true
+	default:
+		return Token{}, p.errorf(args[1].span, "invalid target `%s`, expect %s", node.Target, format)
+	}
+
+	duration := func(i int) (time.Duration, *Error) {
+		if i+1 >= len(args) {
+			return 0, p.errorf(args[i].span, "`%s` require a duration. eg. `3s`", args[i].val)
+		}
+
+		d, err := time.ParseDuration(args[i+1].val)
+
+		if err != nil || d <= 0 {
+			return 0, p.errorf(args[i+1].span, "invalid duration `%s`, expect the duration like `3s` or `1m`", args[i+1].val)
+		}
+
+		return d, nil
+	}
+
+	for i := 3; i < len(args); i += 2 {
+		var err *Error
+
+		switch keyword := args[i].val; {
+		case i+1 >= len(args):
+			err = p.errorf(args[i].span, "`%s` require a value", keyword)
+		case keyword == KeywordON && args[i+1].val == KeywordREMOTE:
+			node.Remote = true
+		case keyword == KeywordON && args[i+1].val == ActionLOCAL:
+			node.Remote = false
+		case keyword == KeywordEVERY:
+			node.Interval, err = duration(i)
+		case keyword == KeywordTIMEOUT:
+			node.Timeout, err = duration(i)
+		case keyword == KeywordSTATUS && node.Target == KeywordHTTP:
+			if node.Status, _ = strconv.Atoi(args[i+1].val); node.Status < 100 || node.Status > 599 {
+				err = p.errorf(args[i+1].span, "invalid status code `%s`", args[i+1].val)
+			}
+		case keyword == KeywordMATCHES && node.Target == KeywordLOG:
+			node.Pattern = args[i+1].val
+
+			if _, e := regexp.Compile(node.Pattern); e != nil {
+				err = p.errorf(args[i+1].span, "invalid pattern `%s`: %s", node.Pattern, e)
+			}
+		default:
+			err = p.errorf(args[i].span, "unexpected `%s` of `%s %s %s`", keyword, ActionWAIT, ActionFOR, node.Target)
+		}
+
+		if err != nil {
+			return Token{}, err
+		}
+	}
+
+	if node.Target == KeywordLOG && node.Pattern == "" {
+		return Token{}, p.errorf(stmt.argsSpan(), "`%s %s %s` require a pattern. eg. `%s \"started\"`", ActionWAIT, ActionFOR, KeywordLOG, KeywordMATCHES)
+	}
+
+	return Token{Key: ActionWAIT, Node: node}, nil
+}
+
+// isBackoffFactor reports whether the argument after BACKOFF is the factor
+func isBackoffFactor(arg string) bool {
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+// parseCondition parses the arguments of the statement as a condition
+//
+//	<left> == <right>
+//	<left> != <right>
+//	EXISTS <remote path>
+//	RUN <command>
+//
+// The condition can be negated with the `NOT` prefix
+func (p *parser) parseCondition(stmt statement) (NodeCondition, *Error) {
+	condition := NodeCondition{}
+	args := stmt.args
+
+	if len(args) > 0 && args[0].val == ConditionNOT {
+		condition.Not = true
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return condition, p.errorf(stmt.span(), "`%s` require a condition", stmt.keyword.val)
+	}
+
+	span := Span{Start: args[0].span.Start, End: args[len(args)-1].span.End}
+
+	switch args[0].val {
+	case ConditionEXISTS:
+		if len(args) != 2 {
+			return condition, p.errorf(span, "`%s` only accepts one path", ConditionEXISTS)
+		}
+
+		condition.Exists = &NodeConditionExists{Path: args[1].val}
+	case KeywordREMOTE:
+		// same as `EXISTS <path>`
+		if len(args) != 4 || args[1].val != KeywordFILE || !strings.EqualFold(args[3].val, ConditionEXISTS) {
+			return condition, p.errorf(span, "`%s` need to match `%s %s <path> %s` format", KeywordREMOTE, KeywordREMOTE, KeywordFILE, ConditionEXISTS)
+		}
+
+		condition.Exists = &NodeConditionExists{Path: args[2].val}
+	case ActionRUN:
+		// `RUN <command> CONTAINS <text>` checks the stdout of command
+		if n := len(args); n > 3 && args[n-2].val == KeywordCONTAINS {
+			text := args[n-1].val
+			condition.Contains = &text
+			args = args[:n-2]
+		}
+
+		if len(args) < 2 {
+			return condition, p.errorf(span, "`%s` require a command", ActionRUN)
+		}
+
+		command, err := p.parseCommand(statement{args: args[1:]}, false)
+
+		if err != nil {
+			return condition, p.errorf(span, "%s", err)
+		}
+
+		condition.Command = &command
+	default:
+		if len(args) != 3 || (args[1].val != OperatorEqual && args[1].val != OperatorNotEqual) {
+			return condition, p.errorf(span, "invalid condition `%s`, expect `<left> %s <right>`, `%s <path>` or `%s <command>`", statement{args: args}.raw(p.input), OperatorEqual, ConditionEXISTS, ActionRUN)
+		}
+
+		condition.Compare = &NodeConditionCompare{
+			Left:     args[0].val,
+			Operator: args[1].val,
+			Right:    args[2].val,
+		}
+	}
+
+	return condition, nil
+}
+
+// parseRunCommand parses the command of RUN. If it is a JSON array, it runs in local
+func parseRunCommand(cmd string) (NodeRunCommand, error) {
+	cmd = strings.TrimSpace(cmd)
+
+	command := NodeRunCommand{SourceCode: cmd}
+
+	if strings.HasPrefix(cmd, "[") && strings.HasSuffix(cmd, "]") {
+		command.RunInLocal = true
+		if err := json.Unmarshal([]byte(cmd), &command.Command); err != nil {
+			return command, fmt.Errorf("invalid local command '%s'", cmd)
+		}
+	} else {
+		command.RunInLocal = false
+		command.Command = trimArrayString(strings.Split(cmd, "&&"))
+	}
+
+	return command, nil
+}
+
+// parseCommand parses the command of RUN. eg. `ls && pwd`, `["ls", "-l"]`, `LOCAL ls | wc -l` or heredoc.
+// The command runs with the shell of local if it starts with LOCAL or local is true
+func (p *parser) parseCommand(stmt statement, local bool) (NodeRunCommand, error) {
+	args := stmt.args
+
+	if len(args) > 0 && args[0].val == ActionLOCAL {
+		local = true
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return NodeRunCommand{}, fmt.Errorf("`%s` require a command", ActionLOCAL)
+	}
+
+	if stmt.heredoc != nil {
+		return p.parseRunScript(args, *stmt.heredoc, local)
+	}
+
+	cmd := statement{args: args}.raw(p.input)
+
+	if local {
+		return NodeRunCommand{RunInLocal: true, Script: cmd, SourceCode: cmd}, nil
+	}
+
+	return parseRunCommand(cmd)
+}
+
+// parseRunScript parses the RUN with heredoc. eg.
+//
+//	RUN [LOCAL] <<EOF
+//	...
+//	EOF
+//
+// If there are other arguments, the heredoc belongs to the command. eg. `RUN cat > app.conf <<EOF`
+func (p *parser) parseRunScript(args []item, heredoc item, local bool) (NodeRunCommand, error) {
+	command := NodeRunCommand{
+		RunInLocal: local,
+		SourceCode: statement{args: args}.raw(p.input),
+	}
+
+	for _, arg := range args {
+		m := heredocReg.FindStringSubmatch(p.input[arg.offset:arg.end])
+
+		if m == nil {
+			continue
+		}
+
+		// the delimiter is quoted
+		command.Verbatim = m[3] == ""
+
+		if len(args) == 1 {
+			command.Script = heredoc.val
+		} else {
+			command.Script = command.SourceCode + "\n" + heredoc.val + m[1] + m[2] + m[3] + "\n"
+		}
+
+		return command, nil
+	}
+
+	return command, fmt.Errorf("missing the start of heredoc")
+}
+
+// parseDefine parses `DEFINE <name>(<param>, ...) ... END`. It is only allowed at the top level
+func (p *parser) parseDefine(stmt statement) (Token, *Error) {
+	node := NodeDefine{
+		SourceCode: stmt.raw(p.input),
+	}
+
+	var headErr *Error
+
+	if p.depth > 1 {
+		headErr = p.errorf(stmt.keyword.span, "`%s` is only allowed at the top level", ActionDEFINE)
+	} else if !stmt.broken {
+		m := defineReg.FindStringSubmatch(node.SourceCode)
+
+		if m == nil {
+			headErr = p.errorf(stmt.argsSpan(), "`%s` need to match `<name>(<param>, ...)` format but got `%s`", ActionDEFINE, node.SourceCode)
+		} else {
+			node.Name = m[1]
+
+			for _, param := range strings.Split(m[2], ",") {
+				if param = strings.TrimSpace(param); param == "" {
+					continue
+				}
+
+				if !envKeyReg.MatchString(param) {
+					headErr = p.errorf(stmt.argsSpan(), "invalid parameter `%s`", param)
+					break
+				}
+
+				node.Params = append(node.Params, param)
+			}
+		}
+	}
+
+	body, end, err := p.parseBody(stmt)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	node.Body = body
+	node.Span = Span{Start: stmt.keyword.span.Start, End: end}
+
+	if headErr != nil {
+		return Token{}, headErr
+	}
+
+	return Token{Key: ActionDEFINE, Node: node}, nil
+}
+
+func (p *parser) parseStatement(stmt statement) (Token, *Error) {
+	keyword := stmt.keyword.val
+
+	if !isAction(keyword) {
+		return Token{}, p.errorf(stmt.keyword.span, "invalid keyword `%s`", keyword)
+	}
+
+	// value must set
+	if len(stmt.args) == 0 {
+		return Token{}, p.errorf(stmt.keyword.span, "`%s` require value", keyword)
+	}
+
+	value := stmt.values()
+	valueStr := stmt.raw(p.input)
+	span := stmt.span()
+
+	switch keyword {
+	case ActionCONNECT:
+		// use the unquoted values, so the password can contain spaces
+		addr, err := host.Parse(strings.Join(value, spaceBlank))
+
+		if err != nil {
+			return Token{}, p.errorf(stmt.argsSpan(), "%s", err)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeConnect{
+				Host:        addr.Host,
+				Port:        addr.Port,
+				Username:    addr.Username,
+				ConnectType: addr.ConnectType,
+				Password:    addr.Password,
+				SourceCode:  valueStr,
+				Span:        span,
+			},
+		}, nil
+	case ActionENV:
+		if len(value) < 3 || value[1] != "=" || !envKeyReg.MatchString(value[0]) {
+			return Token{}, p.errorf(stmt.argsSpan(), "`ENV` need to match `KEY = VALUE` format but got `%s`", valueStr)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeEnv{
+				Key:        value[0],
+				Value:      strings.Join(value[2:], spaceBlank),
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionCD:
+		if len(value) != 1 {
+			return Token{}, p.errorf(stmt.argsSpan(), "`CD` only accepts one string but got `%s`", valueStr)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeCd{
+				Target:     value[0],
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionUPLOAD, ActionDOWNLOAD:
+		if len(value) < 2 {
+			return Token{}, p.errorf(stmt.argsSpan(), "`%s` accepts at least two parameters but got `%s`", keyword, valueStr)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeUpload{
+				SourceFiles:    value[:len(value)-1],
+				DestinationDir: value[len(value)-1],
+				SourceCode:     valueStr,
+				Span:           span,
+			},
+		}, nil
+	case ActionCOPY, ActionMOVE:
+		if len(value) != 2 {
+			return Token{}, p.errorf(stmt.argsSpan(), "`%s` only accepts two string but got `%s`", keyword, valueStr)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeCopy{
+				Source:      value[0],
+				Destination: value[1],
+				SourceCode:  valueStr,
+				Span:        span,
+			},
+		}, nil
+	case ActionDELETE:
+		return Token{
+			Key: keyword,
+			Node: NodeDelete{
+				Targets:    value,
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionRUN, ActionTRY, ActionLOCAL:
+		command, err := p.parseCommand(stmt, keyword == ActionLOCAL)
+
+		if err != nil {
+			return Token{}, p.errorf(stmt.argsSpan(), "%s", err)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeRun{
+				Commands:        []NodeRunCommand{command},
+				SourceCode:      valueStr,
+				ExitWithCommand: keyword != ActionTRY,
+				Span:            span,
+			},
+		}, nil
+	case ActionCALL:
+		if !taskNameReg.MatchString(value[0]) {
+			return Token{}, p.errorf(stmt.args[0].span, "invalid macro name `%s`", value[0])
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeCall{
+				Name:       value[0],
+				Args:       value[1:],
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionARG:
+		if p.depth > 1 {
+			return Token{}, p.errorf(stmt.keyword.span, "`%s` is only allowed at the top level", ActionARG)
+		}
+
+		m := argReg.FindStringSubmatch(valueStr)
+
+		if m == nil {
+			return Token{}, p.errorf(stmt.argsSpan(), "`%s` need to match `NAME [= default]` format but got `%s`", ActionARG, valueStr)
+		}
+
+		node := NodeArg{
+			Name:       m[1],
+			SourceCode: valueStr,
+			Span:       span,
+		}
+
+		if m[2] != "" {
+			defaultValue := m[3]
+
+			// `ARG NAME = "quoted value"`
+			if len(value) > 2 && value[1] == "=" {
+				defaultValue = strings.Join(value[2:], spaceBlank)
+			}
+
+			node.Default = &defaultValue
+		}
+
+		return Token{Key: keyword, Node: node}, nil
+	case ActionINCLUDE:
+		if len(value) != 1 {
+			return Token{}, p.errorf(stmt.argsSpan(), "`%s` only accepts one file but got `%s`", keyword, valueStr)
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeInclude{
+				Path:       value[0],
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionRETRY:
+		return p.parseRetry(stmt)
+	case ActionWAIT:
+		return p.parseWait(stmt)
+	case ActionTIMEOUT:
+		return p.parseTimeout(stmt)
+	case ActionASSERT:
+		condition, err := p.parseCondition(stmt)
+
+		if err != nil {
+			return Token{}, err
+		}
+
+		return Token{
+			Key: keyword,
+			Node: NodeAssert{
+				Condition:  condition,
+				SourceCode: valueStr,
+				Span:       span,
+			},
+		}, nil
+	case ActionENVFILE, ActionVARFILE:
+		if len(value) != 1 {
+			return Token{}, p.errorf(stmt.argsSpan(), "`%s` only accepts one file but got `%s`", keyword, valueStr)
+		}
+
+		node := NodeEnvFile{
+			Path:       value[0],
+			SourceCode: valueStr,
+			Span:       span,
+		}
+
+		// the same tag as `$KEY:remote`
+		if strings.HasSuffix(node.Path, ":remote") {
+			node.Path = strings.TrimSuffix(node.Path, ":remote")
+			node.Remote = true
+		} else {
+			node.Path = strings.TrimSuffix(node.Path, ":local")
+		}
+
+		return Token{Key: keyword, Node: node}, nil
+	case ActionVAR, ActionSECRET:
+		Var, err := variable.Parse(valueStr)
+
+		if err != nil {
+			return Token{}, p.errorf(stmt.argsSpan(), "%s", err)
+		}
+
+		varNode := NodeVar{
+			Key:        Var.Key,
+			Secret:     keyword == ActionSECRET,
+			SourceCode: valueStr,
+			Span:       span,
+		}
+
+		switch Var.Type {
+		case variable.TypeLiteral:
+			varNode.Literal = &NodeVarLiteral{
+				Value: Var.Value,
+			}
+
+			// `VAR KEY = "quoted value"`
+			if len(value) > 2 && value[1] == "=" {
+				varNode.Literal.Value = strings.Join(value[2:], spaceBlank)
+			}
+		case variable.TypeEnv:
+			varNode.Env = &NodeVarEnv{
+				Local: !Var.Remote,
+				Key:   Var.Value,
+			}
+		case variable.TypeCommand:
+			varNode.Command = &NodeVarCommand{
+				Local:   !Var.Remote,
+				Shell:   Var.Shell,
+				Command: strings.Split(Var.Value, " "),
+				Extract: Var.Extractors,
+			}
+
+			if Var.Shell {
+				varNode.Command.Command = []string{Var.Value}
+			}
+		}
+
+		return Token{
+			Key:  keyword,
+			Node: varNode,
+		}, nil
+	}
+
+	return Token{}, p.errorf(stmt.keyword.span, "invalid keyword `%s`", keyword)
+}
@@ -0,0 +1,980 @@
+package grammar_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func TestParseCollectErrors(t *testing.T) {
+	type args struct {
+		input string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []grammar.Span
+	}{
+		{
+			name: "invalid keyword",
+			args: args{
+				input: "FOO bar",
+			},
+			want: []grammar.Span{span(1, 1, 1, 4)},
+		},
+		{
+			name: "multiple errors",
+			args: args{
+				input: `RUN ls
+FOO bar
+CD a b
+	COPY a
+RUN ls`,
+			},
+			want: []grammar.Span{
+				span(2, 1, 2, 4),
+				span(3, 4, 3, 7),
+				span(4, 7, 4, 8),
+			},
+		},
+		{
+			name: "require value",
+			args: args{
+				input: "\n  CONNECT # nothing here",
+			},
+			want: []grammar.Span{span(2, 3, 2, 10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := grammar.Parse(".s4", tt.args.input)
+
+			var list grammar.ErrorList
+
+			if !errors.As(err, &list) {
+				t.Fatalf("Parse() error = %v, want ErrorList", err)
+			}
+
+			var got []grammar.Span
+
+			for _, e := range list {
+				got = append(got, e.Span)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() error spans = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorCaret(t *testing.T) {
+	_, err := grammar.Parse(".s4", "RUN ls\n\tCD a b\n")
+
+	want := ".s4:2:5: `CD` only accepts one string but got `a b`\n" +
+		" 2 | \tCD a b\n" +
+		"   | \t   ^^^"
+
+	if err == nil || err.Error() != want {
+		t.Errorf("Error() = \n%v\nwant\n%v", err, want)
+	}
+}
+
+func TestParseIf(t *testing.T) {
+	type args struct {
+		input string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []grammar.Token
+		wantErr bool
+	}{
+		{
+			name: "if else",
+			args: args{
+				input: `IF {{ENV}} == prod
+	CD /srv
+ELSE
+	CD /tmp
+END`,
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionIF,
+					Node: grammar.NodeIf{
+						Condition: grammar.NodeCondition{
+							Compare: &grammar.NodeConditionCompare{Left: "{{ENV}}", Operator: "==", Right: "prod"},
+						},
+						Then: []grammar.Token{
+							{
+								Key:  grammar.ActionCD,
+								Node: grammar.NodeCd{Target: "/srv", SourceCode: "/srv", Span: span(2, 2, 2, 9)},
+							},
+						},
+						Else: []grammar.Token{
+							{
+								Key:  grammar.ActionCD,
+								Node: grammar.NodeCd{Target: "/tmp", SourceCode: "/tmp", Span: span(4, 2, 4, 9)},
+							},
+						},
+						SourceCode: "{{ENV}} == prod",
+						Span:       span(1, 1, 5, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "else if",
+			args: args{
+				input: `IF NOT EXISTS /srv/app
+	CD /srv
+ELSE IF RUN test -d /tmp
+	CD /tmp
+END`,
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionIF,
+					Node: grammar.NodeIf{
+						Condition: grammar.NodeCondition{
+							Not:    true,
+							Exists: &grammar.NodeConditionExists{Path: "/srv/app"},
+						},
+						Then: []grammar.Token{
+							{
+								Key:  grammar.ActionCD,
+								Node: grammar.NodeCd{Target: "/srv", SourceCode: "/srv", Span: span(2, 2, 2, 9)},
+							},
+						},
+						Else: []grammar.Token{
+							{
+								Key: grammar.ActionIF,
+								Node: grammar.NodeIf{
+									Condition: grammar.NodeCondition{
+										Command: &grammar.NodeRunCommand{
+											Command:    []string{"test -d /tmp"},
+											SourceCode: "test -d /tmp",
+										},
+									},
+									Then: []grammar.Token{
+										{
+											Key:  grammar.ActionCD,
+											Node: grammar.NodeCd{Target: "/tmp", SourceCode: "/tmp", Span: span(4, 2, 4, 9)},
+										},
+									},
+									SourceCode: "RUN test -d /tmp",
+									Span:       span(3, 6, 5, 4),
+								},
+							},
+						},
+						SourceCode: "NOT EXISTS /srv/app",
+						Span:       span(1, 1, 5, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "missing END",
+			args: args{
+				input: "IF a == b\nRUN ls",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unexpected ELSE",
+			args: args{
+				input: "RUN ls\nELSE",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid condition",
+			args: args{
+				input: "IF a = b\nEND",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grammar.Parse(".s4", tt.args.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFor(t *testing.T) {
+	type args struct {
+		input string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []grammar.Token
+		wantErr bool
+	}{
+		{
+			name: "iterate over items",
+			args: args{
+				input: `FOR service IN api "web app"
+	UPLOAD ./{{service}} /srv
+END`,
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionFOR,
+					Node: grammar.NodeFor{
+						Key:   "service",
+						Items: []string{"api", "web app"},
+						Body: []grammar.Token{
+							{
+								Key: grammar.ActionUPLOAD,
+								Node: grammar.NodeUpload{
+									SourceFiles:    []string{"./{{service}}"},
+									DestinationDir: "/srv",
+									SourceCode:     "./{{service}} /srv",
+									Span:           span(2, 2, 2, 27),
+								},
+							},
+						},
+						SourceCode: `service IN api "web app"`,
+						Span:       span(1, 1, 3, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "iterate over command output",
+			args: args{
+				input: `FOR line IN <= ls /srv
+END
+FOR file IN <= ["ls", "./dist"]
+END`,
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionFOR,
+					Node: grammar.NodeFor{
+						Key:        "line",
+						Command:    &grammar.NodeVarCommand{Local: false, Command: []string{"ls", "/srv"}},
+						Body:       []grammar.Token{},
+						SourceCode: "line IN <= ls /srv",
+						Span:       span(1, 1, 2, 4),
+					},
+				},
+				{
+					Key: grammar.ActionFOR,
+					Node: grammar.NodeFor{
+						Key:        "file",
+						Command:    &grammar.NodeVarCommand{Local: true, Command: []string{"ls", "./dist"}},
+						Body:       []grammar.Token{},
+						SourceCode: `file IN <= ["ls", "./dist"]`,
+						Span:       span(3, 1, 4, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "missing IN",
+			args: args{
+				input: "FOR item a b c\nEND",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing END",
+			args: args{
+				input: "FOR item IN a b c\nRUN ls",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grammar.Parse(".s4", tt.args.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeredoc(t *testing.T) {
+	type args struct {
+		input string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []grammar.Token
+		wantErr bool
+	}{
+		{
+			name: "remote script",
+			args: args{
+				input: `RUN <<EOF
+if [ -d /srv ]; then
+  # comment in script
+  echo "{{name}}" \
+    && ls
+fi
+EOF
+CD /srv`,
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionRUN,
+					Node: grammar.NodeRun{
+						Commands: []grammar.NodeRunCommand{
+							{
+								SourceCode: "<<EOF",
+								Script:     "if [ -d /srv ]; then\n  # comment in script\n  echo \"{{name}}\" \\\n    && ls\nfi\n",
+							},
+						},
+						SourceCode:      "<<EOF",
+						ExitWithCommand: true,
+						Span:            span(1, 1, 7, 4),
+					},
+				},
+				{
+					Key:  grammar.ActionCD,
+					Node: grammar.NodeCd{Target: "/srv", SourceCode: "/srv", Span: span(8, 1, 8, 8)},
+				},
+			},
+		},
+		{
+			name: "local script without interpolation",
+			args: args{
+				input: "IF a == a\n\tTRY LOCAL <<'EOF'\necho {{name}}\n\tEOF\nEND",
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionIF,
+					Node: grammar.NodeIf{
+						Condition: grammar.NodeCondition{
+							Compare: &grammar.NodeConditionCompare{Left: "a", Operator: "==", Right: "a"},
+						},
+						Then: []grammar.Token{
+							{
+								Key: grammar.ActionTRY,
+								Node: grammar.NodeRun{
+									Commands: []grammar.NodeRunCommand{
+										{
+											RunInLocal: true,
+											SourceCode: "<<'EOF'",
+											Script:     "echo {{name}}\n",
+											Verbatim:   true,
+										},
+									},
+									SourceCode: "LOCAL <<'EOF'",
+									Span:       span(2, 2, 4, 5),
+								},
+							},
+						},
+						SourceCode: "a == a",
+						Span:       span(1, 1, 5, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "heredoc of command",
+			args: args{
+				input: "RUN cat > app.conf <<\"EOF\"\nport = 80\nEOF",
+			},
+			want: []grammar.Token{
+				{
+					Key: grammar.ActionRUN,
+					Node: grammar.NodeRun{
+						Commands: []grammar.NodeRunCommand{
+							{
+								SourceCode: `cat > app.conf <<"EOF"`,
+								Script:     "cat > app.conf <<\"EOF\"\nport = 80\nEOF\n",
+								Verbatim:   true,
+							},
+						},
+						SourceCode:      `cat > app.conf <<"EOF"`,
+						ExitWithCommand: true,
+						Span:            span(1, 1, 3, 4),
+					},
+				},
+			},
+		},
+		{
+			name: "unterminated heredoc",
+			args: args{
+				input: "RUN <<EOF\necho hello\nEND",
+			},
+			wantErr: true,
+		},
+		{
+			name: "heredoc for other action",
+			args: args{
+				input: "CD <<EOF\n/srv\nEOF",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grammar.Parse(".s4", tt.args.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLocal(t *testing.T) {
+	input := `LOCAL npm run build && ls ./dist | wc -l
+TRY LOCAL rm -rf ./tmp/*
+VAR commit <= LOCAL git rev-parse HEAD | cut -c1-7
+FOR file IN <= LOCAL ls ./dist/*.js
+END`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionLOCAL,
+			Node: grammar.NodeRun{
+				Commands: []grammar.NodeRunCommand{
+					{
+						RunInLocal: true,
+						SourceCode: "npm run build && ls ./dist | wc -l",
+						Script:     "npm run build && ls ./dist | wc -l",
+					},
+				},
+				SourceCode:      "npm run build && ls ./dist | wc -l",
+				ExitWithCommand: true,
+				Span:            span(1, 1, 1, 41),
+			},
+		},
+		{
+			Key: grammar.ActionTRY,
+			Node: grammar.NodeRun{
+				Commands: []grammar.NodeRunCommand{
+					{
+						RunInLocal: true,
+						SourceCode: "rm -rf ./tmp/*",
+						Script:     "rm -rf ./tmp/*",
+					},
+				},
+				SourceCode: "LOCAL rm -rf ./tmp/*",
+				Span:       span(2, 1, 2, 25),
+			},
+		},
+		{
+			Key: grammar.ActionVAR,
+			Node: grammar.NodeVar{
+				Key: "commit",
+				Command: &grammar.NodeVarCommand{
+					Local:   true,
+					Shell:   true,
+					Command: []string{"git rev-parse HEAD | cut -c1-7"},
+				},
+				SourceCode: "commit <= LOCAL git rev-parse HEAD | cut -c1-7",
+				Span:       span(3, 1, 3, 51),
+			},
+		},
+		{
+			Key: grammar.ActionFOR,
+			Node: grammar.NodeFor{
+				Key: "file",
+				Command: &grammar.NodeVarCommand{
+					Local:   true,
+					Shell:   true,
+					Command: []string{"ls ./dist/*.js"},
+				},
+				Body:       []grammar.Token{},
+				SourceCode: "file IN <= LOCAL ls ./dist/*.js",
+				Span:       span(4, 1, 5, 4),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	if _, err := grammar.Parse(".s4", "RUN LOCAL"); err == nil {
+		t.Errorf("Parse() expect an error for LOCAL without command")
+	}
+}
+
+func TestParseArg(t *testing.T) {
+	input := `ARG TARGET
+ARG REGION=eu
+ARG GREETING = "hello world"`
+
+	str := func(s string) *string {
+		return &s
+	}
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionARG,
+			Node: grammar.NodeArg{
+				Name:       "TARGET",
+				SourceCode: "TARGET",
+				Span:       span(1, 1, 1, 11),
+			},
+		},
+		{
+			Key: grammar.ActionARG,
+			Node: grammar.NodeArg{
+				Name:       "REGION",
+				Default:    str("eu"),
+				SourceCode: "REGION=eu",
+				Span:       span(2, 1, 2, 14),
+			},
+		},
+		{
+			Key: grammar.ActionARG,
+			Node: grammar.NodeArg{
+				Name:       "GREETING",
+				Default:    str("hello world"),
+				SourceCode: `GREETING = "hello world"`,
+				Span:       span(3, 1, 3, 29),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"ARG", "ARG a b", "IF a == a\nARG a\nEND"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseAssert(t *testing.T) {
+	input := `ASSERT {{VERSION}} == 1.4.2
+ASSERT REMOTE FILE /srv/app/bin exists
+ASSERT NOT RUN curl -s localhost:8080/health CONTAINS "not ok"`
+
+	str := func(s string) *string {
+		return &s
+	}
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionASSERT,
+			Node: grammar.NodeAssert{
+				Condition: grammar.NodeCondition{
+					Compare: &grammar.NodeConditionCompare{Left: "{{VERSION}}", Operator: "==", Right: "1.4.2"},
+				},
+				SourceCode: "{{VERSION}} == 1.4.2",
+				Span:       span(1, 1, 1, 28),
+			},
+		},
+		{
+			Key: grammar.ActionASSERT,
+			Node: grammar.NodeAssert{
+				Condition: grammar.NodeCondition{
+					Exists: &grammar.NodeConditionExists{Path: "/srv/app/bin"},
+				},
+				SourceCode: "REMOTE FILE /srv/app/bin exists",
+				Span:       span(2, 1, 2, 39),
+			},
+		},
+		{
+			Key: grammar.ActionASSERT,
+			Node: grammar.NodeAssert{
+				Condition: grammar.NodeCondition{
+					Not: true,
+					Command: &grammar.NodeRunCommand{
+						Command:    []string{"curl -s localhost:8080/health"},
+						SourceCode: "curl -s localhost:8080/health",
+					},
+					Contains: str("not ok"),
+				},
+				SourceCode: `NOT RUN curl -s localhost:8080/health CONTAINS "not ok"`,
+				Span:       span(3, 1, 3, 63),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"ASSERT", "ASSERT a b", "ASSERT REMOTE FILE /srv", "ASSERT RUN"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseRetry(t *testing.T) {
+	input := `RETRY 5 EVERY 3s RUN ./check.sh
+RETRY 3 BACKOFF JITTER UPLOAD ./dist /srv
+RETRY 2 BACKOFF 1.5 CALL restart api`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionRETRY,
+			Node: grammar.NodeRetry{
+				Times:    5,
+				Interval: 3 * time.Second,
+				Backoff:  1,
+				Step: grammar.Token{
+					Key: grammar.ActionRUN,
+					Node: grammar.NodeRun{
+						Commands:        []grammar.NodeRunCommand{{Command: []string{"./check.sh"}, SourceCode: "./check.sh"}},
+						ExitWithCommand: true,
+						SourceCode:      "./check.sh",
+						Span:            span(1, 18, 1, 32),
+					},
+				},
+				SourceCode: "5 EVERY 3s RUN ./check.sh",
+				Span:       span(1, 1, 1, 32),
+			},
+		},
+		{
+			Key: grammar.ActionRETRY,
+			Node: grammar.NodeRetry{
+				Times:    3,
+				Interval: time.Second,
+				Backoff:  2,
+				Jitter:   true,
+				Step: grammar.Token{
+					Key: grammar.ActionUPLOAD,
+					Node: grammar.NodeUpload{
+						SourceFiles:    []string{"./dist"},
+						DestinationDir: "/srv",
+						SourceCode:     "./dist /srv",
+						Span:           span(2, 24, 2, 42),
+					},
+				},
+				SourceCode: "3 BACKOFF JITTER UPLOAD ./dist /srv",
+				Span:       span(2, 1, 2, 42),
+			},
+		},
+		{
+			Key: grammar.ActionRETRY,
+			Node: grammar.NodeRetry{
+				Times:    2,
+				Interval: time.Second,
+				Backoff:  1.5,
+				Step: grammar.Token{
+					Key: grammar.ActionCALL,
+					Node: grammar.NodeCall{
+						Name:       "restart",
+						Args:       []string{"api"},
+						SourceCode: "restart api",
+						Span:       span(3, 21, 3, 37),
+					},
+				},
+				SourceCode: "2 BACKOFF 1.5 CALL restart api",
+				Span:       span(3, 1, 3, 37),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"RETRY", "RETRY 0 RUN ls", "RETRY 3", "RETRY 3 EVERY soon RUN ls", "RETRY 3 BACKOFF 0.5 RUN ls", "RETRY 3 FOR x IN a\nEND", "RETRY 3 RUN"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	input := `WAIT FOR PORT 8080 ON REMOTE TIMEOUT 30s
+WAIT FOR HTTP http://localhost/health STATUS 204 EVERY 2s
+WAIT FOR LOG /var/log/app.log MATCHES started`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionWAIT,
+			Node: grammar.NodeWait{
+				Target:     grammar.KeywordPORT,
+				Value:      "8080",
+				Remote:     true,
+				Interval:   time.Second,
+				Timeout:    30 * time.Second,
+				SourceCode: "FOR PORT 8080 ON REMOTE TIMEOUT 30s",
+				Span:       span(1, 1, 1, 41),
+			},
+		},
+		{
+			Key: grammar.ActionWAIT,
+			Node: grammar.NodeWait{
+				Target:     grammar.KeywordHTTP,
+				Value:      "http://localhost/health",
+				Status:     204,
+				Interval:   2 * time.Second,
+				Timeout:    time.Minute,
+				SourceCode: "FOR HTTP http://localhost/health STATUS 204 EVERY 2s",
+				Span:       span(2, 1, 2, 58),
+			},
+		},
+		{
+			Key: grammar.ActionWAIT,
+			Node: grammar.NodeWait{
+				Target:     grammar.KeywordLOG,
+				Value:      "/var/log/app.log",
+				Pattern:    "started",
+				Remote:     true,
+				Interval:   time.Second,
+				Timeout:    time.Minute,
+				SourceCode: "FOR LOG /var/log/app.log MATCHES started",
+				Span:       span(3, 1, 3, 46),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"WAIT", "WAIT FOR PORT", "WAIT FOR DB x", "WAIT FOR LOG /app.log", "WAIT FOR LOG /app.log MATCHES (", "WAIT FOR HTTP http://x STATUS 999", "WAIT FOR PORT 80 TIMEOUT soon", "WAIT FOR PORT 80 STATUS 200", "WAIT FOR FILE /x ON"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	input := `TIMEOUT 5m RUN ./deploy.sh
+TIMEOUT 30s RETRY 3 CALL restart`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionTIMEOUT,
+			Node: grammar.NodeTimeout{
+				Timeout: 5 * time.Minute,
+				Step: grammar.Token{
+					Key: grammar.ActionRUN,
+					Node: grammar.NodeRun{
+						Commands:        []grammar.NodeRunCommand{{Command: []string{"./deploy.sh"}, SourceCode: "./deploy.sh"}},
+						ExitWithCommand: true,
+						SourceCode:      "./deploy.sh",
+						Span:            span(1, 12, 1, 27),
+					},
+				},
+				SourceCode: "5m RUN ./deploy.sh",
+				Span:       span(1, 1, 1, 27),
+			},
+		},
+		{
+			Key: grammar.ActionTIMEOUT,
+			Node: grammar.NodeTimeout{
+				Timeout: 30 * time.Second,
+				Step: grammar.Token{
+					Key: grammar.ActionRETRY,
+					Node: grammar.NodeRetry{
+						Times:    3,
+						Interval: time.Second,
+						Backoff:  1,
+						Step: grammar.Token{
+							Key: grammar.ActionCALL,
+							Node: grammar.NodeCall{
+								Name:       "restart",
+								Args:       []string{},
+								SourceCode: "restart",
+								Span:       span(2, 21, 2, 33),
+							},
+						},
+						SourceCode: "3 CALL restart",
+						Span:       span(2, 13, 2, 33),
+					},
+				},
+				SourceCode: "30s RETRY 3 CALL restart",
+				Span:       span(2, 1, 2, 33),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"TIMEOUT", "TIMEOUT 5m", "TIMEOUT soon RUN ls", "TIMEOUT 0s RUN ls", "TIMEOUT 5m IF a == b\nEND"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseParallel(t *testing.T) {
+	input := `PARALLEL
+  UPLOAD ./dist /srv
+  RUN npm ci
+END`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionPARALLEL,
+			Node: grammar.NodeParallel{
+				Body: []grammar.Token{
+					{
+						Key: grammar.ActionUPLOAD,
+						Node: grammar.NodeUpload{
+							SourceFiles:    []string{"./dist"},
+							DestinationDir: "/srv",
+							SourceCode:     "./dist /srv",
+							Span:           span(2, 3, 2, 21),
+						},
+					},
+					{
+						Key: grammar.ActionRUN,
+						Node: grammar.NodeRun{
+							Commands:        []grammar.NodeRunCommand{{Command: []string{"npm ci"}, SourceCode: "npm ci"}},
+							ExitWithCommand: true,
+							SourceCode:      "npm ci",
+							Span:            span(3, 3, 3, 13),
+						},
+					},
+				},
+				Span: span(1, 1, 4, 4),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"PARALLEL\nRUN ls", "PARALLEL 2\nEND", "PARALLEL\nCD /srv\nEND", "PARALLEL\nVAR a = 1\nEND", "PARALLEL\nCONNECT root@localhost:22\nEND", "RETRY 3 PARALLEL", "PARALLEL\nIF a == a\nCD /srv\nEND\nEND", "PARALLEL\nFOR x IN 1 2\nRETRY 2 VAR a <= ls\nEND\nEND", "PARALLEL\nPARALLEL\nENV A = 1\nEND\nEND"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
+
+func TestParseOnFailureAndFinally(t *testing.T) {
+	input := `ON FAILURE
+  RUN ln -sfn {{PREVIOUS}} /srv/current
+END
+FINALLY
+  DELETE /srv/maintenance
+END`
+
+	want := []grammar.Token{
+		{
+			Key: grammar.ActionON,
+			Node: grammar.NodeOnFailure{
+				Body: []grammar.Token{
+					{
+						Key: grammar.ActionRUN,
+						Node: grammar.NodeRun{
+							Commands:        []grammar.NodeRunCommand{{Command: []string{"ln -sfn {{PREVIOUS}} /srv/current"}, SourceCode: "ln -sfn {{PREVIOUS}} /srv/current"}},
+							ExitWithCommand: true,
+							SourceCode:      "ln -sfn {{PREVIOUS}} /srv/current",
+							Span:            span(2, 3, 2, 40),
+						},
+					},
+				},
+				SourceCode: "FAILURE",
+				Span:       span(1, 1, 3, 4),
+			},
+		},
+		{
+			Key: grammar.ActionFINALLY,
+			Node: grammar.NodeFinally{
+				Body: []grammar.Token{
+					{
+						Key: grammar.ActionDELETE,
+						Node: grammar.NodeDelete{
+							Targets:    []string{"/srv/maintenance"},
+							SourceCode: "/srv/maintenance",
+							Span:       span(5, 3, 5, 26),
+						},
+					},
+				},
+				Span: span(4, 1, 6, 4),
+			},
+		},
+	}
+
+	got, err := grammar.Parse(".s4", input)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	for _, input := range []string{"ON FAILURE\nRUN ls", "ON\nEND", "ON SUCCESS\nEND", "FINALLY now\nEND", "TASK deploy\nFINALLY\nEND\nEND", "IF a == a\nON FAILURE\nEND\nEND", "RETRY 3 FINALLY"} {
+		if _, err := grammar.Parse(".s4", input); err == nil {
+			t.Errorf("Parse(%q) expect error", input)
+		}
+	}
+}
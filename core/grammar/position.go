@@ -0,0 +1,134 @@
+package grammar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a location in the source. Line and Column start from 1
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the source range of a node. End is exclusive
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location returns the span itself, so every node which embeds a Span can report where it comes from
+func (s Span) Location() Span {
+	return s
+}
+
+// Locatable is implemented by all nodes produced by the parser
+type Locatable interface {
+	Location() Span
+}
+
+// Error is a syntax error at a position of the source
+type Error struct {
+	File   string
+	Span   Span
+	Msg    string
+	Source string // the source line where the error occurs
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+
+	if e.File != "" {
+		b.WriteString(e.File + ":")
+	}
+
+	b.WriteString(fmt.Sprintf("%s: %s", e.Span.Start, e.Msg))
+
+	if e.Source == "" {
+		return b.String()
+	}
+
+	// print the source line with a caret pointing at the offending source
+	//
+	//   3 | FOO bar
+	//     | ^^^
+	lineNumber := fmt.Sprintf("%d", e.Span.Start.Line)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	b.WriteString(fmt.Sprintf("\n %s | %s\n %s | ", lineNumber, e.Source, gutter))
+
+	// keep tabs in the indentation, so the caret will be aligned with the source
+	col := 1
+	for _, r := range e.Source {
+		if col >= e.Span.Start.Column {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		col++
+	}
+
+	width := 1
+
+	if e.Span.End.Line == e.Span.Start.Line && e.Span.End.Column > e.Span.Start.Column {
+		width = e.Span.End.Column - e.Span.Start.Column
+	} else if e.Span.End.Line > e.Span.Start.Line {
+		// the span crosses multiple lines, underline to the end of the first line
+		if rest := utf8.RuneCountInString(e.Source) - e.Span.Start.Column + 1; rest > 1 {
+			width = rest
+		}
+	}
+
+	b.WriteString(strings.Repeat("^", width))
+
+	return b.String()
+}
+
+// ErrorList is a list of syntax errors, sorted by position
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	var messages []string
+
+	for _, e := range l {
+		messages = append(messages, e.Error())
+	}
+
+	return fmt.Sprintf("%s\n\n%d errors found", strings.Join(messages, "\n\n"), len(l))
+}
+
+// Err returns nil if there is no error in the list
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].File != l[j].File {
+			return l[i].File < l[j].File
+		}
+		a, b := l[i].Span.Start, l[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return l
+}
@@ -0,0 +1,115 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultTask is the task which runs without specifying a task name
+const DefaultTask = "default"
+
+// FindTasks collects the tasks defined at the top level, including the top level of the included files
+func FindTasks(tokens []Token) ([]NodeTask, error) {
+	var tasks []NodeTask
+
+	// where the task is defined. eg. common.s4:3:1
+	defined := map[string]string{}
+
+	var walk func(tokens []Token, file string) error
+
+	walk = func(tokens []Token, file string) error {
+		for _, token := range tokens {
+			switch node := token.Node.(type) {
+			case NodeTask:
+				location := node.Start.String()
+
+				if file != "" {
+					location = file + ":" + location
+				}
+
+				if exist, ok := defined[node.Name]; ok {
+					return fmt.Errorf("task `%s` at %s has been defined at %s", node.Name, location, exist)
+				}
+
+				defined[node.Name] = location
+				tasks = append(tasks, node)
+			case NodeInclude:
+				if err := walk(node.Body, node.File); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(tokens, ""); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// ResolveTask returns the task and its dependencies in topological order, the dependencies come first
+func ResolveTask(tokens []Token, name string) ([]NodeTask, error) {
+	tasks, err := FindTasks(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defined := map[string]NodeTask{}
+
+	for _, task := range tasks {
+		defined[task.Name] = task
+	}
+
+	var (
+		result  []NodeTask
+		visited = map[string]bool{}
+		stack   []string // the tasks being visited, for cycle detection
+	)
+
+	var visit func(name string, by string) error
+
+	visit = func(name string, by string) error {
+		task, ok := defined[name]
+
+		if !ok {
+			if by == "" {
+				return fmt.Errorf("task `%s` is not defined", name)
+			}
+			return fmt.Errorf("task `%s` depends on undefined task `%s`", by, name)
+		}
+
+		for i, n := range stack {
+			if n == name {
+				return fmt.Errorf("circular dependency of task `%s`", strings.Join(append(stack[i:], name), "` -> `"))
+			}
+		}
+
+		if visited[name] {
+			return nil
+		}
+
+		stack = append(stack, name)
+
+		for _, dependency := range task.Depends {
+			if err := visit(dependency, name); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		visited[name] = true
+		result = append(result, task)
+
+		return nil
+	}
+
+	if err := visit(name, ""); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package grammar_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func TestResolveTask(t *testing.T) {
+	type args struct {
+		input string
+		name  string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "basic",
+			args: args{
+				input: `TASK build
+END
+TASK test DEPENDS build
+END
+TASK lint
+END
+TASK deploy DEPENDS lint test build
+END`,
+				name: "deploy",
+			},
+			want: []string{"lint", "build", "test", "deploy"},
+		},
+		{
+			name: "without dependencies",
+			args: args{
+				input: "TASK build\nEND\nTASK deploy DEPENDS build\nEND",
+				name:  "build",
+			},
+			want: []string{"build"},
+		},
+		{
+			name: "undefined task",
+			args: args{
+				input: "TASK build\nEND",
+				name:  "deploy",
+			},
+			wantErr: true,
+		},
+		{
+			name: "undefined dependency",
+			args: args{
+				input: "TASK deploy DEPENDS build\nEND",
+				name:  "deploy",
+			},
+			wantErr: true,
+		},
+		{
+			name: "circular dependency",
+			args: args{
+				input: "TASK a DEPENDS b\nEND\nTASK b DEPENDS c\nEND\nTASK c DEPENDS a\nEND",
+				name:  "a",
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate task",
+			args: args{
+				input: "TASK a\nEND\nTASK a\nEND",
+				name:  "a",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := grammar.Parse(".s4", tt.args.input)
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			tasks, err := grammar.ResolveTask(tokens, tt.args.name)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveTask() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var got []string
+
+			for _, task := range tasks {
+				got = append(got, task.Name)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveTask() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTaskErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "nested task", input: "IF a == a\nTASK build\nEND\nEND"},
+		{name: "missing name", input: "TASK\nEND"},
+		{name: "missing dependencies", input: "TASK deploy DEPENDS\nEND"},
+		{name: "invalid dependencies", input: "TASK deploy build\nEND"},
+		{name: "missing END", input: "TASK deploy\nRUN ls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grammar.Parse(".s4", tt.input); err == nil {
+				t.Errorf("Parse() expect error")
+			}
+		})
+	}
+}
@@ -3,87 +3,259 @@ package grammar
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/axetroy/s4/core/host"
 	"github.com/axetroy/s4/core/variable"
 )
 
 type Token struct {
-	Key  string
-	Node interface{}
+	Key  string      `json:"key"`
+	Node interface{} `json:"node"`
 }
 
 type NodeUpload struct {
-	SourceFiles    []string
-	DestinationDir string
-	SourceCode     string
+	SourceFiles    []string `json:"source_files"`
+	DestinationDir string   `json:"destination_dir"`
+	SourceCode     string   `json:"source_code"`
+	Span
 }
 
 type NodeConnect struct {
-	Host        string
-	Port        string
-	Username    string
-	ConnectType *string
-	Password    *string
-	SourceCode  string
+	Host        string  `json:"host"`
+	Port        string  `json:"port"`
+	Username    string  `json:"username"`
+	ConnectType *string `json:"connect_type"`
+	Password    *string `json:"password"`
+	SourceCode  string  `json:"source_code"`
+	Span
+}
+
+// MarshalJSON hides the password, the JSON is read by the other tools
+func (n NodeConnect) MarshalJSON() ([]byte, error) {
+	type node NodeConnect
+
+	if n.Password != nil && n.ConnectType != nil && *n.ConnectType == host.ConnectTypePassword {
+		masked := variable.MaskText
+
+		n.Password = &masked
+		n.SourceCode = fmt.Sprintf("%s@%s:%s %s %s %s", n.Username, n.Host, n.Port, KeywordWITH, *n.ConnectType, masked)
+	}
+
+	return json.Marshal(node(n))
 }
 
 type NodeEnv struct {
-	Key        string
-	Value      string
-	SourceCode string
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	SourceCode string `json:"source_code"`
+	Span
 }
 
 type NodeVar struct {
-	Key        string
-	Literal    *NodeVarLiteral
-	Env        *NodeVarEnv
-	Command    *NodeVarCommand
-	SourceCode string
+	Key        string          `json:"key"`
+	Literal    *NodeVarLiteral `json:"literal"`
+	Env        *NodeVarEnv     `json:"env"`
+	Command    *NodeVarCommand `json:"command"`
+	Secret     bool            `json:"secret"` // defined by SECRET, the value is masked in the output
+	SourceCode string          `json:"source_code"`
+	Span
+}
+
+// MarshalJSON hides the literal value of SECRET, the JSON is read by the other tools
+func (n NodeVar) MarshalJSON() ([]byte, error) {
+	type node NodeVar
+
+	if n.Secret && n.Literal != nil {
+		n.Literal = &NodeVarLiteral{Value: variable.MaskText}
+		n.SourceCode = n.Key + " = " + variable.MaskText
+	}
+
+	return json.Marshal(node(n))
 }
 
 type NodeVarLiteral struct {
-	Value string
+	Value string `json:"value"`
 }
 
 type NodeVarEnv struct {
-	Local bool
-	Key   string
+	Local bool   `json:"local"`
+	Key   string `json:"key"`
 }
 
 type NodeVarCommand struct {
-	Local   bool
-	Command []string
+	Local   bool                 `json:"local"`
+	Shell   bool                 `json:"shell"` // run with the shell of local, the command is the whole script. eg. `LOCAL ls | wc -l`
+	Command []string             `json:"command"`
+	Extract []variable.Extractor `json:"extract"` // extract a part of the stdout. eg. `VAR VERSION <= cat package.json | json .version`
 }
 
 type NodeCopy struct {
-	Source      string
-	Destination string
-	SourceCode  string
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	SourceCode  string `json:"source_code"`
+	Span
 }
 
 type NodeRun struct {
-	Commands        []NodeRunCommand
-	SourceCode      string
-	ExitWithCommand bool // if command run fail. Whether to exit the process
+	Commands        []NodeRunCommand `json:"commands"`
+	SourceCode      string           `json:"source_code"`
+	ExitWithCommand bool             `json:"exit_with_command"` // if command run fail. Whether to exit the process
+	Span
 }
 
 type NodeRunCommand struct {
-	Command    []string
-	RunInLocal bool
-	SourceCode string
+	Command    []string `json:"command"`
+	RunInLocal bool     `json:"run_in_local"`
+	SourceCode string   `json:"source_code"`
+	Script     string   `json:"script"`   // the script which runs with shell. eg. heredoc or the command of LOCAL
+	Verbatim   bool     `json:"verbatim"` // do not interpolate the variables in script. eg. <<'EOF'
 }
 
 type NodeDelete struct {
-	Targets    []string
-	SourceCode string
+	Targets    []string `json:"targets"`
+	SourceCode string   `json:"source_code"`
+	Span
 }
 
 type NodeCd struct {
-	Target     string
-	SourceCode string
+	Target     string `json:"target"`
+	SourceCode string `json:"source_code"`
+	Span
+}
+
+type NodeIf struct {
+	Condition  NodeCondition `json:"condition"`
+	Then       []Token       `json:"then"`
+	Else       []Token       `json:"else"`
+	SourceCode string        `json:"source_code"`
+	Span
+}
+
+type NodeFor struct {
+	Key        string          `json:"key"`     // the name of loop variable
+	Items      []string        `json:"items"`   // FOR item IN a b c
+	Command    *NodeVarCommand `json:"command"` // FOR line IN <= command, iterate over the lines of stdout
+	Body       []Token         `json:"body"`
+	SourceCode string          `json:"source_code"`
+	Span
+}
+
+type NodeTask struct {
+	Name       string   `json:"name"`
+	Depends    []string `json:"depends"` // the tasks which run before this task
+	Body       []Token  `json:"body"`
+	SourceCode string   `json:"source_code"`
+	Span
+}
+
+type NodeDefine struct {
+	Name       string   `json:"name"`
+	Params     []string `json:"params"`
+	Body       []Token  `json:"body"`
+	SourceCode string   `json:"source_code"`
+	Span
+}
+
+type NodeCall struct {
+	Name       string   `json:"name"`
+	Args       []string `json:"args"` // the values of the macro parameters
+	SourceCode string   `json:"source_code"`
+	Span
+}
+
+type NodeArg struct {
+	Name       string  `json:"name"`
+	Default    *string `json:"default"` // the ARG is required if there is no default value
+	SourceCode string  `json:"source_code"`
+	Span
+}
+
+type NodeEnvFile struct {
+	Path       string `json:"path"`   // the path of env file, relative to the current working directory
+	Remote     bool   `json:"remote"` // the file is at remote server. eg. `ENVFILE .env:remote`
+	SourceCode string `json:"source_code"`
+	Span
+}
+
+type NodeInclude struct {
+	Path       string  `json:"path"` // the path as it is written, relative to the including file
+	File       string  `json:"file"` // the resolved path of the included file
+	Body       []Token `json:"body"` // the tokens of the included file
+	SourceCode string  `json:"source_code"`
+	Span
+}
+
+type NodeCondition struct {
+	Not      bool                  `json:"not"` // the condition is negated with `NOT`
+	Compare  *NodeConditionCompare `json:"compare"`
+	Exists   *NodeConditionExists  `json:"exists"`
+	Command  *NodeRunCommand       `json:"command"`  // true if the command exit with status 0
+	Contains *string               `json:"contains"` // the stdout of command contains the text. eg. `RUN curl localhost CONTAINS ok`
+}
+
+type NodeAssert struct {
+	Condition  NodeCondition `json:"condition"`
+	SourceCode string        `json:"source_code"`
+	Span
+}
+
+type NodeRetry struct {
+	Times      int           `json:"times"`    // the step runs at most the times
+	Interval   time.Duration `json:"interval"` // the interval before the next attempt
+	Backoff    float64       `json:"backoff"`  // the interval is multiplied by the factor after each attempt, 1 means no backoff
+	Jitter     bool          `json:"jitter"`   // randomize the interval, so the attempts of many workflows do not hit the server at the same time
+	Step       Token         `json:"step"`
+	SourceCode string        `json:"source_code"`
+	Span
+}
+
+type NodeTimeout struct {
+	Timeout    time.Duration `json:"timeout"` // the step is stopped and fails if it does not finish in the duration
+	Step       Token         `json:"step"`
+	SourceCode string        `json:"source_code"`
+	Span
+}
+
+type NodeParallel struct {
+	Body       []Token `json:"body"` // each step runs concurrently
+	SourceCode string  `json:"source_code"`
+	Span
+}
+
+type NodeOnFailure struct {
+	Body       []Token `json:"body"` // the steps run if a step of workflow fails
+	SourceCode string  `json:"source_code"`
+	Span
+}
+
+type NodeFinally struct {
+	Body       []Token `json:"body"` // the steps run after the workflow, no matter it succeeds or fails
+	SourceCode string  `json:"source_code"`
+	Span
+}
+
+type NodeWait struct {
+	Target     string        `json:"target"`   // PORT, HTTP, FILE or LOG
+	Value      string        `json:"value"`    // the port, url or path
+	Status     int           `json:"status"`   // the expected status code of HTTP, 0 means any 2xx
+	Pattern    string        `json:"pattern"`  // the pattern which the new lines of LOG matches
+	Remote     bool          `json:"remote"`   // check at remote server. PORT and HTTP are at local by default, FILE and LOG are at remote
+	Interval   time.Duration `json:"interval"` // the interval between the checks
+	Timeout    time.Duration `json:"timeout"`  // the step fails if the condition is not ready in time
+	SourceCode string        `json:"source_code"`
+	Span
+}
+
+type NodeConditionCompare struct {
+	Left     string `json:"left"`
+	Operator string `json:"operator"`
+	Right    string `json:"right"`
+}
+
+type NodeConditionExists struct {
+	Path string `json:"path"` // remote file path
 }
 
 const (
@@ -98,6 +270,52 @@ const (
 	ActionDELETE   = "DELETE"
 	ActionRUN      = "RUN"
 	ActionTRY      = "TRY"
+	ActionIF       = "IF"
+	ActionELSE     = "ELSE"
+	ActionEND      = "END"
+	ActionFOR      = "FOR"
+	ActionINCLUDE  = "INCLUDE"
+	ActionTASK     = "TASK"
+	ActionDEFINE   = "DEFINE"
+	ActionCALL     = "CALL"
+	ActionLOCAL    = "LOCAL"
+	ActionARG      = "ARG"
+	ActionSECRET   = "SECRET"
+	ActionENVFILE  = "ENVFILE"
+	ActionVARFILE  = "VARFILE"
+	ActionASSERT   = "ASSERT"
+	ActionRETRY    = "RETRY"
+	ActionWAIT     = "WAIT"
+	ActionTIMEOUT  = "TIMEOUT"
+	ActionPARALLEL = "PARALLEL"
+	ActionON       = "ON"
+	ActionFINALLY  = "FINALLY"
+)
+
+const (
+	ConditionNOT    = "NOT"
+	ConditionEXISTS = "EXISTS"
+
+	KeywordIN       = "IN"
+	KeywordDEPENDS  = "DEPENDS"
+	KeywordREMOTE   = "REMOTE"
+	KeywordFILE     = "FILE"
+	KeywordCONTAINS = "CONTAINS"
+	KeywordEVERY    = "EVERY"
+	KeywordBACKOFF  = "BACKOFF"
+	KeywordJITTER   = "JITTER"
+	KeywordON       = "ON"
+	KeywordTIMEOUT  = "TIMEOUT"
+	KeywordSTATUS   = "STATUS"
+	KeywordMATCHES  = "MATCHES"
+	KeywordPORT     = "PORT"
+	KeywordHTTP     = "HTTP"
+	KeywordLOG      = "LOG"
+	KeywordFAILURE  = "FAILURE"
+	KeywordWITH     = "WITH"
+
+	OperatorEqual    = "=="
+	OperatorNotEqual = "!="
 )
 
 var (
@@ -113,350 +331,43 @@ var (
 		ActionDELETE,
 		ActionRUN,
 		ActionTRY,
+		ActionIF,
+		ActionELSE,
+		ActionEND,
+		ActionFOR,
+		ActionINCLUDE,
+		ActionTASK,
+		ActionDEFINE,
+		ActionCALL,
+		ActionLOCAL,
+		ActionARG,
+		ActionSECRET,
+		ActionENVFILE,
+		ActionVARFILE,
+		ActionASSERT,
+		ActionRETRY,
+		ActionWAIT,
+		ActionTIMEOUT,
+		ActionPARALLEL,
+		ActionON,
+		ActionFINALLY,
 	}
-	commentIdentifier = "#"
-	validKeywordReg   = regexp.MustCompile(strings.Join(Actions, "|"))
-	keywordRed        = regexp.MustCompile("[A-Z]")
-	emptyStrReg       = regexp.MustCompile("\\s")
-	lineWrapReg       = regexp.MustCompile("\\\r?\\\n")
-	lineBreakChar     = "\\"
-	spaceBlank        = " "
+	spaceBlank = " "
 )
 
-func isAllowLineBreakAction(actionName string) bool {
-	return actionName == ActionRUN || actionName == ActionTRY
-}
-
-func Tokenizer(input string) ([]Token, error) {
-	currentIndex := 0
-
-	tokens := make([]Token, 0)
-
-	for {
-		if currentIndex >= len(input)-1 {
-			break
-		}
-
-		char := string(input[currentIndex])
-
-		// if found line break. skip
-		if lineWrapReg.MatchString(char) {
-			currentIndex++
-			continue
-		}
-
-		// if found space blank. skip
-		if emptyStrReg.MatchString(char) {
-			currentIndex++
-			continue
+func isAction(keyword string) bool {
+	for _, action := range Actions {
+		if action == keyword {
+			return true
 		}
-
-		// if found comment. skip
-		if char == commentIdentifier {
-		findCommentContent:
-			for {
-				if currentIndex > len(input)-1 {
-					break findCommentContent
-				}
-				char = string(input[currentIndex])
-				if lineWrapReg.MatchString(char) {
-					break findCommentContent
-				} else {
-					currentIndex++
-				}
-			}
-			continue
-		}
-
-		// if match the keyword
-		if keywordRed.MatchString(char) == true {
-			var (
-				keyword      = ""
-				value        []string
-				currentValue = ""
-			)
-
-		findKeyword:
-			for {
-				if currentIndex > len(input)-1 {
-					break
-				}
-				char = string(input[currentIndex])
-
-				if keywordRed.MatchString(char) == false {
-					break findKeyword
-				}
-
-				keyword += char
-
-				currentIndex++
-			}
-
-			// valid keyword
-			if validKeywordReg.MatchString(keyword) == false {
-				return tokens, fmt.Errorf("invalid keyword `%s`", keyword)
-			}
-
-		skipEmptyString:
-			for {
-				if currentIndex > len(input)-1 {
-					break
-				}
-				char = string(input[currentIndex])
-				if emptyStrReg.MatchString(char) {
-					currentIndex++
-				} else {
-					break skipEmptyString
-				}
-			}
-
-		findValue:
-			for {
-				if currentIndex > len(input)-1 {
-					break findValue
-				}
-
-				char = string(input[currentIndex])
-
-				// if found line wrap, eg. \n
-				if lineWrapReg.MatchString(char) {
-
-					// only allow RUN to use line break
-					if isAllowLineBreakAction(keyword) {
-						// find space blank forward and skip it.
-						lastCharIndex := currentIndex - 1
-						lastChar := ""
-					findSpace:
-						for {
-							lastChar = string(input[lastCharIndex])
-
-							if emptyStrReg.MatchString(lastChar) {
-								lastCharIndex--
-								continue
-							}
-
-							break findSpace
-						}
-
-						if lastChar == lineBreakChar {
-							currentIndex++
-							currentValue = strings.TrimRight(currentValue, "\\")
-							continue
-						}
-					}
-
-					break findValue
-				}
-
-				// if found comment, then ignore future content
-				if char == commentIdentifier {
-					break findValue
-				}
-
-				// if in space link in value, so we think it's an other value
-				if emptyStrReg.MatchString(char) {
-					value = append(value, currentValue)
-					currentValue = ""
-					currentIndex++
-					continue findValue
-				}
-
-				currentValue += char
-
-				currentIndex++
-			}
-
-			if len(currentValue) != 0 {
-				value = append(value, currentValue)
-			}
-
-			currentValue = ""
-
-			// value must set
-			if len(value) == 0 {
-				return tokens, fmt.Errorf("`%s` require value", keyword)
-			}
-
-			// validate token here
-			valueStr := strings.Join(value, spaceBlank)
-			valueLength := len(value)
-
-			if isAllowLineBreakAction(keyword) {
-
-				valueStr := regexp.MustCompile("\\\\\\s+").ReplaceAllString(valueStr, "")
-
-				value = strings.Split(valueStr, spaceBlank)
-			}
-
-			switch keyword {
-			case ActionCONNECT:
-				if addr, err := host.Parse(valueStr); err != nil {
-					return tokens, err
-				} else {
-					tokens = append(tokens, Token{
-						Key: keyword,
-						Node: NodeConnect{
-							Host:        addr.Host,
-							Port:        addr.Port,
-							Username:    addr.Username,
-							ConnectType: addr.ConnectType,
-							Password:    addr.Password,
-							SourceCode:  valueStr,
-						},
-					})
-				}
-				break
-			case ActionENV:
-				if regexp.MustCompile("\\w+\\s?=\\s?\\w+").MatchString(valueStr) == false {
-					return tokens, fmt.Errorf("`ENV` need to match `KEY = VALUE` format but got `%s`", valueStr)
-				}
-
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeEnv{
-						Key:        value[0],
-						Value:      value[2],
-						SourceCode: valueStr,
-					},
-				})
-
-				break
-			case ActionCD:
-				if valueLength != 1 {
-					return tokens, fmt.Errorf("`CD` only accepts one string but got `%s`", valueStr)
-				}
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeCd{
-						Target:     valueStr,
-						SourceCode: valueStr,
-					},
-				})
-				break
-			case ActionUPLOAD:
-				fallthrough
-			case ActionDOWNLOAD:
-				if valueLength < 2 {
-					return tokens, fmt.Errorf("`%s` only accepts one string but got `%s`", keyword, valueStr)
-				}
-
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeUpload{
-						SourceFiles:    value[:len(value)-1],
-						DestinationDir: value[len(value)-1],
-						SourceCode:     valueStr,
-					},
-				})
-
-				break
-			case ActionCOPY:
-				fallthrough
-			case ActionMOVE:
-				if valueLength != 2 {
-					return tokens, fmt.Errorf("`%s` only accepts two string but got `%s`", keyword, valueStr)
-				}
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeCopy{
-						Source:      value[0],
-						Destination: value[1],
-						SourceCode:  valueStr,
-					},
-				})
-				break
-			case ActionDELETE:
-				if valueLength < 1 {
-					return tokens, fmt.Errorf("`%s` accepts at least one parameter but got `%s`", keyword, valueStr)
-				}
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeDelete{
-						Targets:    value,
-						SourceCode: valueStr,
-					},
-				})
-				break
-			case ActionTRY:
-				fallthrough
-			case ActionRUN:
-				if valueLength < 1 {
-					return tokens, fmt.Errorf("`%s` accepts at least one parameter but got `%s`", keyword, valueStr)
-				}
-
-				commands := make([]NodeRunCommand, 0)
-
-				cmd := strings.TrimSpace(valueStr)
-
-				command := NodeRunCommand{SourceCode: cmd}
-
-				if strings.HasPrefix(cmd, "[") && strings.HasSuffix(cmd, "]") {
-					command.RunInLocal = true
-					if err := json.Unmarshal([]byte(cmd), &command.Command); err != nil {
-						return tokens, fmt.Errorf("invalid local command '%s'", cmd)
-					}
-				} else {
-					command.RunInLocal = false
-					command.Command = trimArrayString(strings.Split(cmd, "&&"))
-				}
-
-				commands = append(commands, command)
-
-				tokens = append(tokens, Token{
-					Key: keyword,
-					Node: NodeRun{
-						Commands:        commands,
-						SourceCode:      valueStr,
-						ExitWithCommand: keyword == ActionRUN,
-					},
-				})
-
-				break
-
-			case ActionVAR:
-				varNode := NodeVar{}
-
-				if Var, err := variable.Parse(valueStr); err != nil {
-					return nil, err
-				} else {
-					varNode.Key = Var.Key
-					varNode.SourceCode = valueStr
-
-					switch Var.Type {
-					case variable.TypeLiteral:
-						varNode.Literal = &NodeVarLiteral{
-							Value: Var.Value,
-						}
-						break
-					case variable.TypeEnv:
-						varNode.Env = &NodeVarEnv{
-							Local: !Var.Remote,
-							Key:   Var.Value,
-						}
-						break
-					case variable.TypeCommand:
-						varNode.Command = &NodeVarCommand{
-							Local:   !Var.Remote,
-							Command: strings.Split(Var.Value, " "),
-						}
-						break
-					}
-				}
-
-				tokens = append(tokens, Token{
-					Key:  keyword,
-					Node: varNode,
-				})
-				break
-			}
-
-			continue
-		}
-
-		return tokens, fmt.Errorf("invalid token `%s`", char)
 	}
 
-	return tokens, nil
+	return false
+}
+
+// Tokenizer parses the source without a file name. See Parse
+func Tokenizer(input string) ([]Token, error) {
+	return Parse("", input)
 }
 
 func trimArrayString(arr []string) []string {
@@ -10,6 +10,13 @@ import (
 	"github.com/axetroy/s4/core/host"
 )
 
+func span(startLine, startColumn, endLine, endColumn int) grammar.Span {
+	return grammar.Span{
+		Start: grammar.Position{Line: startLine, Column: startColumn},
+		End:   grammar.Position{Line: endLine, Column: endColumn},
+	}
+}
+
 func TestTokenizer(t *testing.T) {
 	type args struct {
 		input string
@@ -47,6 +54,7 @@ TRY ls -lh
 						},
 						SourceCode:      "ls -lh",
 						ExitWithCommand: true,
+						Span:            span(1, 1, 1, 11),
 					},
 				},
 				{
@@ -55,6 +63,7 @@ TRY ls -lh
 						Source:      "data.db",
 						Destination: "data.db.bak",
 						SourceCode:  "data.db data.db.bak",
+						Span:        span(2, 1, 2, 25),
 					},
 				},
 				{
@@ -63,6 +72,7 @@ TRY ls -lh
 						Source:      "data.db",
 						Destination: "data.db.bak",
 						SourceCode:  "data.db data.db.bak",
+						Span:        span(3, 1, 3, 25),
 					},
 				},
 				{
@@ -70,6 +80,7 @@ TRY ls -lh
 					Node: grammar.NodeDelete{
 						Targets:    []string{"file1.txt", "file2.txt"},
 						SourceCode: "file1.txt file2.txt",
+						Span:       span(4, 1, 4, 27),
 					},
 				},
 				{
@@ -84,6 +95,7 @@ TRY ls -lh
 						},
 						SourceCode:      "ls -lh",
 						ExitWithCommand: false,
+						Span:            span(5, 1, 5, 11),
 					},
 				},
 			},
@@ -106,6 +118,7 @@ TRY ls -lh
 						},
 						SourceCode:      "192.168.0.1",
 						ExitWithCommand: true,
+						Span:            span(1, 1, 1, 20),
 					},
 				},
 			},
@@ -129,6 +142,7 @@ RUN     192.168.0.1`,
 						},
 						SourceCode:      "192.168.0.1",
 						ExitWithCommand: true,
+						Span:            span(2, 1, 2, 20),
 					},
 				},
 			},
@@ -151,6 +165,7 @@ RUN     192.168.0.1`,
 						},
 						SourceCode:      "192.168.0.1",
 						ExitWithCommand: true,
+						Span:            span(1, 1, 1, 16),
 					},
 				},
 			},
@@ -178,6 +193,7 @@ RUN ls -lh
 						Port:       "22",
 						Username:   "axetroy",
 						SourceCode: "axetroy@192.168.0.1:22",
+						Span:       span(1, 1, 1, 31),
 					},
 				},
 				{
@@ -192,6 +208,7 @@ RUN ls -lh
 						},
 						SourceCode:      "ls -lh",
 						ExitWithCommand: true,
+						Span:            span(2, 1, 2, 11),
 					},
 				},
 			},
@@ -208,6 +225,7 @@ RUN ls -lh
 						SourceFiles:    []string{"./README.md", "./start.py"},
 						DestinationDir: "./dist",
 						SourceCode:     "./README.md ./start.py ./dist",
+						Span:           span(1, 1, 1, 37),
 					},
 				},
 			},
@@ -235,6 +253,7 @@ RUN ls -lh
 						ConnectType: &host.ConnectTypePassword,
 						Password:    &password,
 						SourceCode:  "root@192.168.0.1:2222 WITH PASSWORD 123123",
+						Span:        span(1, 1, 1, 51),
 					},
 				},
 			},
@@ -255,6 +274,7 @@ RUN ls -lh
 						ConnectType: &host.ConnectTypePrivateKeyFile,
 						Password:    &privateKeyFile,
 						SourceCode:  "root@192.168.0.1:2222 WITH FILE ./path/to/private/key/file",
+						Span:        span(1, 1, 1, 67),
 					},
 				},
 			},
@@ -312,6 +332,7 @@ RUN ls -lh
 						Key:        "PRIVATE_KEY",
 						Value:      "xxx",
 						SourceCode: "PRIVATE_KEY = xxx",
+						Span:       span(1, 1, 1, 22),
 					},
 				},
 			},
@@ -334,11 +355,12 @@ RUN yarn \
 							{
 								Command:    []string{"yarn", "npm run build", "env"},
 								RunInLocal: false,
-								SourceCode: "yarn  && npm run build  && env",
+								SourceCode: "yarn && npm run build && env",
 							},
 						},
-						SourceCode:      `yarn  && npm run build  && env`,
+						SourceCode:      `yarn && npm run build && env`,
 						ExitWithCommand: true,
+						Span:            span(2, 1, 4, 8),
 					},
 				},
 			},
@@ -364,6 +386,7 @@ RUN yarn \
 						},
 						SourceCode:      `yarn && env`,
 						ExitWithCommand: true,
+						Span:            span(1, 1, 2, 7),
 					},
 				},
 			},
@@ -383,6 +406,71 @@ RUN yarn \
 						Key:        "name",
 						Literal:    &grammar.NodeVarLiteral{Value: "axetroy"},
 						SourceCode: "name = axetroy",
+						Span:       span(2, 3, 2, 21),
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "parse secret",
+			args: args{
+				input: `
+		SECRET password = hunter2
+		SECRET token = $TOKEN:local
+		`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "SECRET",
+					Node: grammar.NodeVar{
+						Key:        "password",
+						Literal:    &grammar.NodeVarLiteral{Value: "hunter2"},
+						Secret:     true,
+						SourceCode: "password = hunter2",
+						Span:       span(2, 3, 2, 28),
+					},
+				},
+				{
+					Key: "SECRET",
+					Node: grammar.NodeVar{
+						Key: "token",
+						Env: &grammar.NodeVarEnv{
+							Local: true,
+							Key:   "TOKEN",
+						},
+						Secret:     true,
+						SourceCode: "token = $TOKEN:local",
+						Span:       span(3, 3, 3, 30),
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "parse env file",
+			args: args{
+				input: `
+		ENVFILE ./deploy/.env.production
+		VARFILE .env:remote
+		`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "ENVFILE",
+					Node: grammar.NodeEnvFile{
+						Path:       "./deploy/.env.production",
+						SourceCode: "./deploy/.env.production",
+						Span:       span(2, 3, 2, 35),
+					},
+				},
+				{
+					Key: "VARFILE",
+					Node: grammar.NodeEnvFile{
+						Path:       ".env",
+						Remote:     true,
+						SourceCode: ".env:remote",
+						Span:       span(3, 3, 3, 22),
 					},
 				},
 			},
@@ -406,6 +494,7 @@ RUN yarn \
 							Key:   "HOME",
 						},
 						SourceCode: "remote_home = $HOME:remote",
+						Span:       span(2, 3, 2, 33),
 					},
 				},
 				{
@@ -417,6 +506,7 @@ RUN yarn \
 							Key:   "HOME",
 						},
 						SourceCode: "local_home = $HOME:local",
+						Span:       span(3, 3, 3, 31),
 					},
 				},
 			},
@@ -440,6 +530,7 @@ RUN yarn \
 							Command: []string{"echo", "$HOME"},
 						},
 						SourceCode: `local_home <= ["echo", "$HOME"]`,
+						Span:       span(2, 3, 2, 38),
 					},
 				},
 				{
@@ -451,6 +542,7 @@ RUN yarn \
 							Command: []string{"echo", "$HOME"},
 						},
 						SourceCode: `remote_home <= echo $HOME`,
+						Span:       span(3, 3, 3, 32),
 					},
 				},
 			},
@@ -476,11 +568,141 @@ RUN yarn \
 						},
 						SourceCode:      `["npm", "run", "build"]`,
 						ExitWithCommand: true,
+						Span:            span(2, 3, 2, 30),
 					},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "quoted arguments",
+			args: args{
+				input: `UPLOAD "my file.txt" 'assets dir' /srv
+CD "/opt/My App"
+COPY 'it\'s.db' "backup\\it's.db"
+DELETE my\ file.txt`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "UPLOAD",
+					Node: grammar.NodeUpload{
+						SourceFiles:    []string{"my file.txt", "assets dir"},
+						DestinationDir: "/srv",
+						SourceCode:     `"my file.txt" 'assets dir' /srv`,
+						Span:           span(1, 1, 1, 39),
+					},
+				},
+				{
+					Key: "CD",
+					Node: grammar.NodeCd{
+						Target:     "/opt/My App",
+						SourceCode: `"/opt/My App"`,
+						Span:       span(2, 1, 2, 17),
+					},
+				},
+				{
+					Key: "COPY",
+					Node: grammar.NodeCopy{
+						Source:      "it's.db",
+						Destination: `backup\it's.db`,
+						SourceCode:  `'it\'s.db' "backup\\it's.db"`,
+						Span:        span(3, 1, 3, 34),
+					},
+				},
+				{
+					Key: "DELETE",
+					Node: grammar.NodeDelete{
+						Targets:    []string{"my file.txt"},
+						SourceCode: `my\ file.txt`,
+						Span:       span(4, 1, 4, 20),
+					},
+				},
+			},
+		},
+		{
+			name: "ENV value with spaces",
+			args: args{
+				input: `ENV GREETING = hello world
+ENV NAME = "  s4  "
+VAR title = "hello \"s4\""`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "ENV",
+					Node: grammar.NodeEnv{
+						Key:        "GREETING",
+						Value:      "hello world",
+						SourceCode: "GREETING = hello world",
+						Span:       span(1, 1, 1, 27),
+					},
+				},
+				{
+					Key: "ENV",
+					Node: grammar.NodeEnv{
+						Key:        "NAME",
+						Value:      "  s4  ",
+						SourceCode: `NAME = "  s4  "`,
+						Span:       span(2, 1, 2, 20),
+					},
+				},
+				{
+					Key: "VAR",
+					Node: grammar.NodeVar{
+						Key:        "title",
+						Literal:    &grammar.NodeVarLiteral{Value: `hello "s4"`},
+						SourceCode: `title = "hello \"s4\""`,
+						Span:       span(3, 1, 3, 27),
+					},
+				},
+			},
+		},
+		{
+			name: "template with blanks is one argument",
+			args: args{
+				input: `CD /srv/{{ name | default "my app" }} # comment`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "CD",
+					Node: grammar.NodeCd{
+						Target:     `/srv/{{ name | default "my app" }}`,
+						SourceCode: `/srv/{{ name | default "my app" }}`,
+						Span:       span(1, 1, 1, 38),
+					},
+				},
+			},
+		},
+		{
+			name: "quoted string in RUN is kept as it is",
+			args: args{
+				input: `RUN echo "a  # b" && echo 'c'`,
+			},
+			want: []grammar.Token{
+				{
+					Key: "RUN",
+					Node: grammar.NodeRun{
+						Commands: []grammar.NodeRunCommand{
+							{
+								Command:    []string{`echo "a  # b"`, `echo 'c'`},
+								RunInLocal: false,
+								SourceCode: `echo "a  # b" && echo 'c'`,
+							},
+						},
+						SourceCode:      `echo "a  # b" && echo 'c'`,
+						ExitWithCommand: true,
+						Span:            span(1, 1, 1, 30),
+					},
+				},
+			},
+		},
+		{
+			name: "unterminated quoted string",
+			args: args{
+				input: `CD "/opt/My App`,
+			},
+			want:    []grammar.Token{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -499,3 +721,79 @@ RUN yarn \
 		})
 	}
 }
+
+// the JSON of tokens is consumed by the other tools, the field names must be stable
+func TestTokenJSON(t *testing.T) {
+	tokens, err := grammar.Tokenizer("FOR f IN a\n  CD /srv\nEND")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(tokens)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"key":"FOR","node":{"key":"f","items":["a"],"command":null,"body":[{"key":"CD","node":{"target":"/srv","source_code":"/srv","start":{"line":2,"column":3},"end":{"line":2,"column":10}}}],"source_code":"f IN a","start":{"line":1,"column":1},"end":{"line":3,"column":4}}}]`
+
+	if string(b) != want {
+		t.Errorf("json = %s, want %s", b, want)
+	}
+}
+
+// the secrets are not revealed in the JSON of tokens
+func TestTokenJSONSecret(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "secret",
+			input: `SECRET TOKEN = "abc\"123"`,
+			want:  `{"key":"TOKEN","literal":{"value":"***"},"env":null,"command":null,"secret":true,"source_code":"TOKEN = ***","start":{"line":1,"column":1},"end":{"line":1,"column":26}}`,
+		},
+		{
+			name:  "secret from env",
+			input: `SECRET TOKEN = $TOKEN:local`,
+			want:  `{"key":"TOKEN","literal":null,"env":{"local":true,"key":"TOKEN"},"command":null,"secret":true,"source_code":"TOKEN = $TOKEN:local","start":{"line":1,"column":1},"end":{"line":1,"column":28}}`,
+		},
+		{
+			name:  "var",
+			input: `VAR TOKEN = abc123`,
+			want:  `{"key":"TOKEN","literal":{"value":"abc123"},"env":null,"command":null,"secret":false,"source_code":"TOKEN = abc123","start":{"line":1,"column":1},"end":{"line":1,"column":19}}`,
+		},
+		{
+			name:  "password",
+			input: `CONNECT root@localhost:22 WITH PASSWORD abc123`,
+			want:  `{"host":"localhost","port":"22","username":"root","connect_type":"PASSWORD","password":"***","source_code":"root@localhost:22 WITH PASSWORD ***","start":{"line":1,"column":1},"end":{"line":1,"column":47}}`,
+		},
+		{
+			name:  "private key file",
+			input: `CONNECT root@localhost:22 WITH FILE ./id_rsa`,
+			want:  `{"host":"localhost","port":"22","username":"root","connect_type":"FILE","password":"./id_rsa","source_code":"root@localhost:22 WITH FILE ./id_rsa","start":{"line":1,"column":1},"end":{"line":1,"column":45}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := grammar.Tokenizer(tt.input)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := json.Marshal(tokens[0].Node)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(b) != tt.want {
+				t.Errorf("json = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
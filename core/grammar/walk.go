@@ -0,0 +1,62 @@
+package grammar
+
+// Children returns the blocks of the token. eg. the THEN and ELSE of IF
+func Children(token Token) [][]Token {
+	switch node := token.Node.(type) {
+	case NodeIf:
+		return [][]Token{node.Then, node.Else}
+	case NodeFor:
+		return [][]Token{node.Body}
+	case NodeTask:
+		return [][]Token{node.Body}
+	case NodeDefine:
+		return [][]Token{node.Body}
+	case NodeInclude:
+		return [][]Token{node.Body}
+	case NodeRetry:
+		return [][]Token{{node.Step}}
+	case NodeTimeout:
+		return [][]Token{{node.Step}}
+	case NodeParallel:
+		return [][]Token{node.Body}
+	case NodeOnFailure:
+		return [][]Token{node.Body}
+	case NodeFinally:
+		return [][]Token{node.Body}
+	}
+
+	return nil
+}
+
+// Walk visits the tokens in order, including the tokens in blocks and included files.
+// The file is empty for the root file. The children of token are skipped if fn returns false
+func Walk(tokens []Token, fn func(token Token, file string) bool) {
+	walk(tokens, "", fn)
+}
+
+func walk(tokens []Token, file string, fn func(token Token, file string) bool) {
+	for _, token := range tokens {
+		if !fn(token, file) {
+			continue
+		}
+
+		childFile := file
+
+		if include, ok := token.Node.(NodeInclude); ok {
+			childFile = include.File
+		}
+
+		for _, children := range Children(token) {
+			walk(children, childFile, fn)
+		}
+	}
+}
+
+// location formats the position with file name. eg. common.s4:3:1
+func location(file string, pos Position) string {
+	if file == "" {
+		return pos.String()
+	}
+
+	return file + ":" + pos.String()
+}
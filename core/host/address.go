@@ -24,8 +24,11 @@ type Address struct {
 	Password    *string
 }
 
+// template matches the variable in address, it is rendered when connecting. eg. `{{USER}}@{{HOST}}:22`
+const template = `\{\{[^{}]*\}\}`
+
 var (
-	addressReg = regexp.MustCompile(fmt.Sprintf("^([\\w-\\.]+)@([\\w\\.-]+):(\\d+)\\s*(WITH\\s+(%s)\\s+(.*))?$", strings.Join(ConnectTypes, "|")))
+	addressReg = regexp.MustCompile(fmt.Sprintf("^((?:[\\w\\.-]|%s)+)@((?:[\\w\\.-]|%s)+):((?:\\d|%s)+)\\s*(WITH\\s+(%s)\\s+(.*))?$", template, template, template, strings.Join(ConnectTypes, "|")))
 )
 
 func Parse(address string) (Address, error) {
@@ -30,6 +30,24 @@ func TestParseAddress(t *testing.T) {
 				Username: "root",
 			},
 		},
+		{
+			name: "template",
+			args: args{
+				address: "{{USER}}@{{ HOST }}.example.com:{{PORT}}",
+			},
+			want: host.Address{
+				Host:     "{{ HOST }}.example.com",
+				Port:     "{{PORT}}",
+				Username: "{{USER}}",
+			},
+		},
+		{
+			name: "invalid template",
+			args: args{
+				address: "{{USER@192.168.0.1:22",
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid-1",
 			args: args{
@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"github.com/axetroy/s4/core/grammar"
+)
+
+type keywordDoc struct {
+	syntax      string
+	description string
+}
+
+// markdown returns the document of keyword in markdown
+func (d keywordDoc) markdown() string {
+	return "```s4\n" + d.syntax + "\n```\n\n" + d.description
+}
+
+// docs of the keywords for hover and completion
+var docs = map[string]keywordDoc{
+	grammar.ActionCONNECT: {
+		syntax:      "CONNECT <user>@<host>:<port> [WITH PASSWORD <password> | WITH FILE <private_key_file>]",
+		description: "Connect to the server with the password or the private key file. The password is asked in terminal if neither is provided. The user, host and port can be variables, eg. `{{HOST}}`.",
+	},
+	grammar.ActionENV: {
+		syntax:      "ENV <key> = <value>",
+		description: "Set environment variable for the commands.",
+	},
+	grammar.ActionVAR: {
+		syntax:      "VAR <name> = <value>\nVAR <name> = $ENV_NAME[:remote]\nVAR <name> <= [LOCAL] <command>\nVAR <name> <= <command> | json <path> | regex <pattern> | line <n>",
+		description: "Define a variable from string literal, environment variable or the stdout of command. A part of stdout is taken by `json`, `regex` or `line` at the end of command. Use it with `{{name}}`.",
+	},
+	grammar.ActionCD: {
+		syntax:      "CD <dir>",
+		description: "Change current working directory of remote server.",
+	},
+	grammar.ActionUPLOAD: {
+		syntax:      "UPLOAD <local_file>... <remote_dir>",
+		description: "Upload local files to remote server dir.",
+	},
+	grammar.ActionDOWNLOAD: {
+		syntax:      "DOWNLOAD <remote_file>... <local_dir>",
+		description: "Download remote files to local dir.",
+	},
+	grammar.ActionCOPY: {
+		syntax:      "COPY <source> <destination>",
+		description: "Copy file at remote server.",
+	},
+	grammar.ActionMOVE: {
+		syntax:      "MOVE <source> <destination>",
+		description: "Move file at remote server.",
+	},
+	grammar.ActionDELETE: {
+		syntax:      "DELETE <remote_file>...",
+		description: "Delete files at remote server. The protected paths such as `/` or `/usr` are skipped.",
+	},
+	grammar.ActionRUN: {
+		syntax:      "RUN <command>\nRUN [\"command\", \"arg\"]\nRUN LOCAL <command>\nRUN <<EOF",
+		description: "Run command at remote server. The command of JSON array or with `LOCAL` runs at local machine. The workflow stops if the command fails.",
+	},
+	grammar.ActionTRY: {
+		syntax:      "TRY <command>",
+		description: "Same as `RUN`, but will proceed to the next step regardless of the results.",
+	},
+	grammar.ActionIF: {
+		syntax:      "IF [NOT] <left> == <right>\nIF [NOT] EXISTS <remote_path>\nIF [NOT] RUN [LOCAL] <command>",
+		description: "Run steps only when the condition is true. The block ends with `END`.",
+	},
+	grammar.ActionELSE: {
+		syntax:      "ELSE\nELSE IF <condition>",
+		description: "Run steps when the conditions before are false.",
+	},
+	grammar.ActionEND: {
+		syntax:      "END",
+		description: "End the block of `IF`, `FOR`, `TASK` or `DEFINE`.",
+	},
+	grammar.ActionFOR: {
+		syntax:      "FOR <name> IN <item>...\nFOR <name> IN <= [LOCAL] <command>",
+		description: "Repeat steps for each item, the item is available as `{{name}}`. The block ends with `END`.",
+	},
+	grammar.ActionINCLUDE: {
+		syntax:      "INCLUDE <file>",
+		description: "Include the steps of another s4 file. The path is relative to the current file.",
+	},
+	grammar.ActionTASK: {
+		syntax:      "TASK <name> [DEPENDS <task>...]",
+		description: "Define a named task, run it with `s4 run <task>`. The dependencies run before the task.",
+	},
+	grammar.ActionDEFINE: {
+		syntax:      "DEFINE <name>(<param>, ...)",
+		description: "Define a parameterised macro, run it with `CALL`. The parameters are available as variables in the body.",
+	},
+	grammar.ActionCALL: {
+		syntax:      "CALL <name> <argument>...",
+		description: "Call a macro with arguments.",
+	},
+	grammar.ActionLOCAL: {
+		syntax:      "LOCAL <command>",
+		description: "Run command with the shell of local machine.",
+	},
+	grammar.ActionARG: {
+		syntax:      "ARG <name> [= <default>]",
+		description: "Declare a parameter of workflow, pass it with `--var name=value` or `--var-file vars.env`. It is required if there is no default value.",
+	},
+	grammar.ActionSECRET: {
+		syntax:      "SECRET <name> = <value>\nSECRET <name> = $ENV_NAME[:remote]\nSECRET <name> <= [LOCAL] <command>",
+		description: "Same as `VAR`, but the value is replaced with `***` in the output, such as the steps, the errors and the output of remote commands.",
+	},
+	grammar.ActionENVFILE: {
+		syntax:      "ENVFILE <file>\nENVFILE <file>:remote",
+		description: "Load the environment variables of env file for the commands. The file is at local machine, or at remote server with `:remote`.",
+	},
+	grammar.ActionVARFILE: {
+		syntax:      "VARFILE <file>\nVARFILE <file>:remote",
+		description: "Load the variables of env file. The file is at local machine, or at remote server with `:remote`.",
+	},
+	grammar.ActionASSERT: {
+		syntax:      "ASSERT [NOT] <left> == <right>\nASSERT [NOT] REMOTE FILE <remote_path> EXISTS\nASSERT [NOT] RUN [LOCAL] <command> [CONTAINS <text>]",
+		description: "Verify the condition, the workflow fails with the actual state if it is false.",
+	},
+	grammar.ActionRETRY: {
+		syntax:      "RETRY <times> [EVERY <interval>] [BACKOFF [<factor>]] [JITTER] <step>",
+		description: "Run the step again if it fails, at most the times. The interval is `1s` by default, it is multiplied by the factor of `BACKOFF` (`2` by default) after each attempt.",
+	},
+	grammar.ActionWAIT: {
+		syntax:      "WAIT FOR PORT <[host:]port> [ON REMOTE]\nWAIT FOR HTTP <url> [STATUS <code>] [ON REMOTE]\nWAIT FOR FILE <path> [ON LOCAL]\nWAIT FOR LOG <path> MATCHES <pattern> [ON LOCAL]\n  [EVERY <interval>] [TIMEOUT <timeout>]",
+		description: "Wait until the port is listening, the url responds with the status (any `2xx` by default), the file exists, or the new lines of log match the pattern. The port and url are checked from local machine, the file and log are at remote server by default. It checks every `1s` and fails after `1m` by default.",
+	},
+	grammar.ActionTIMEOUT: {
+		syntax:      "TIMEOUT <duration> <step>",
+		description: "Stop the step and fail if it does not finish in the duration. eg. `5m`. The remote command is signaled with `SIGTERM`, then `SIGKILL` if it does not exit. The whole workflow is limited by `--timeout`.",
+	},
+	grammar.ActionPARALLEL: {
+		syntax:      "PARALLEL\n  <step>\n  ...\nEND",
+		description: "Run the steps concurrently, and wait for all of them. The output of each step is prefixed with its number, and the steps in it are numbered from 1. The other steps are stopped if a step fails. `CONNECT`, `CD`, `ENV`, `ENVFILE`, `VARFILE`, `VAR` and `SECRET` are not allowed, because they change the state of the steps after them.",
+	},
+	grammar.ActionON: {
+		syntax:      "ON FAILURE\n  <step>\n  ...\nEND",
+		description: "Run the steps if a step of workflow fails, eg. to restore the previous release. `{{FAILED_STEP}}` and `{{ERROR}}` are the failed step and its error, quote them with `{{ ERROR | quote }}` when they are passed to shell. It is only allowed at the top level.",
+	},
+	grammar.ActionFINALLY: {
+		syntax:      "FINALLY\n  <step>\n  ...\nEND",
+		description: "Run the steps after the workflow, no matter it succeeds or fails, eg. to remove the maintenance flag. It runs after `ON FAILURE`, and is not limited by `--timeout`. It is only allowed at the top level.",
+	},
+	grammar.ConditionNOT: {
+		syntax:      "IF NOT <condition>",
+		description: "Negate the condition.",
+	},
+	grammar.ConditionEXISTS: {
+		syntax:      "IF EXISTS <remote_path>",
+		description: "The condition is true if the path exists at remote server.",
+	},
+	grammar.KeywordIN: {
+		syntax:      "FOR <name> IN <item>...",
+		description: "The items of `FOR` loop.",
+	},
+	grammar.KeywordCONTAINS: {
+		syntax:      "RUN <command> CONTAINS <text>",
+		description: "The condition is true if the command succeeds and its stdout contains the text.",
+	},
+	grammar.KeywordEVERY: {
+		syntax:      "RETRY <times> EVERY <interval> <step>",
+		description: "The interval before the next attempt. eg. `3s`, `1m`.",
+	},
+	grammar.KeywordBACKOFF: {
+		syntax:      "RETRY <times> BACKOFF [<factor>] <step>",
+		description: "Multiply the interval by the factor after each attempt, `2` by default.",
+	},
+	grammar.KeywordJITTER: {
+		syntax:      "RETRY <times> JITTER <step>",
+		description: "Randomize the interval between its half and itself.",
+	},
+	grammar.KeywordDEPENDS: {
+		syntax:      "TASK <name> DEPENDS <task>...",
+		description: "The tasks which run before the task.",
+	},
+}
@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// the error codes of JSON-RPC
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// request is a request or notification from the client. The notification has no id
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   responseError    `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// readMessage reads a message which is prefixed with the headers. eg. `Content-Length: 52\r\n\r\n{...}`
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid header `Content-Length: %s`", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func writeMessage(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+
+	return err
+}
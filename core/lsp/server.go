@@ -0,0 +1,459 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/variable"
+)
+
+// Server is a language server of s4, it communicates with the editor over JSON-RPC
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]string // the content of opened documents by uri
+}
+
+// NewServer creates a server which reads the requests from in, and writes the responses to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: map[string]string{},
+	}
+}
+
+// Serve handles the requests until the `exit` notification is received or the input is closed
+func (s *Server) Serve() error {
+	for {
+		body, err := readMessage(s.reader)
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var req request
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(req)
+
+		if e, ok := err.(*responseError); ok {
+			err = nil
+
+			// the notification has no response
+			if req.ID != nil {
+				err = s.replyError(req.ID, e.Code, e.Message)
+			}
+		} else if err == nil && req.ID != nil {
+			err = writeMessage(s.writer, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return writeMessage(s.writer, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   responseError{Code: code, Message: message},
+	})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.writer, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(req request) (interface{}, error) {
+	// decode the params into v
+	params := func(v interface{}) error {
+		if err := json.Unmarshal(req.Params, v); err != nil {
+			return &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+
+	switch req.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:   textDocumentSyncFull,
+				CompletionProvider: CompletionOptions{TriggerCharacters: []string{"{"}},
+				HoverProvider:      true,
+				DefinitionProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "s4"},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		s.documents[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.documents[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		delete(s.documents, p.TextDocument.URI)
+		// clear the diagnostics of closed document
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	case "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return s.document(p.TextDocument.URI).completion(p.Position), nil
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return s.document(p.TextDocument.URI).hover(p.Position), nil
+	case "textDocument/definition":
+		var p TextDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		return s.document(p.TextDocument.URI).definition(p.Position), nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method `%s` not found", req.Method)}
+}
+
+func (s *Server) publishDiagnostics(uri string) error {
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: s.document(uri).diagnostics(),
+	})
+}
+
+// document is the parsed content of a text document
+type document struct {
+	uri    string
+	lines  []string
+	tokens []grammar.Token
+	errors grammar.ErrorList
+}
+
+func (s *Server) document(uri string) *document {
+	text := s.documents[uri]
+
+	// the file name is used in the messages
+	file := uri
+
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		file = u.Path
+	}
+
+	// the tokens which have been parsed are kept even though there are syntax errors
+	tokens, err := grammar.Parse(file, text)
+
+	d := &document{
+		uri:    uri,
+		lines:  strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"),
+		tokens: tokens,
+	}
+
+	if list, ok := err.(grammar.ErrorList); ok {
+		d.errors = list
+	}
+
+	return d
+}
+
+// position converts the position of grammar to the position of protocol
+func (d *document) position(p grammar.Position) Position {
+	if p.Line < 1 {
+		return Position{}
+	}
+
+	if p.Line > len(d.lines) {
+		return Position{Line: len(d.lines) - 1, Character: utf16Length(d.lines[len(d.lines)-1])}
+	}
+
+	line := d.lines[p.Line-1]
+	character := 0
+	column := 1
+
+	for _, r := range line {
+		if column >= p.Column {
+			break
+		}
+		character += len(utf16.Encode([]rune{r}))
+		column++
+	}
+
+	return Position{Line: p.Line - 1, Character: character}
+}
+
+func (d *document) rangeOf(span grammar.Span) Range {
+	return Range{Start: d.position(span.Start), End: d.position(span.End)}
+}
+
+// offset returns the line and the byte offset in the line of the position
+func (d *document) offset(p Position) (string, int) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return "", 0
+	}
+
+	line := d.lines[p.Line]
+	character := 0
+
+	for i, r := range line {
+		if character >= p.Character {
+			return line, i
+		}
+		character += len(utf16.Encode([]rune{r}))
+	}
+
+	return line, len(line)
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, e := range d.errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.rangeOf(e.Span),
+			Severity: diagnosticSeverityError,
+			Source:   "s4",
+			Message:  e.Msg,
+		})
+	}
+
+	return diagnostics
+}
+
+// expression returns the name of variable if the position is in a template. eg. {{ name | upper }}
+func (d *document) expression(p Position) (string, bool) {
+	line, offset := d.offset(p)
+
+	start := strings.LastIndex(line[:offset], "{{")
+
+	if start < 0 || strings.Contains(line[start:offset], "}}") {
+		return "", false
+	}
+
+	end := strings.Index(line[offset:], "}}")
+
+	if end < 0 {
+		return "", false
+	}
+
+	references := variable.References(line[start : offset+end+2])
+
+	if len(references) == 0 {
+		return "", false
+	}
+
+	return references[0].Name, true
+}
+
+func (d *document) completion(p Position) []CompletionItem {
+	items := []CompletionItem{}
+
+	line, offset := d.offset(p)
+	prefix := line[:offset]
+
+	// in the template, complete the variables
+	if start := strings.LastIndex(prefix, "{{"); start >= 0 && !strings.Contains(prefix[start:], "}}") {
+		if strings.Contains(prefix[start:], "|") {
+			return items
+		}
+
+		for _, name := range d.variables() {
+			items = append(items, CompletionItem{Label: name, Kind: completionItemKindVariable})
+		}
+
+		return items
+	}
+
+	// the keyword is the first word of statement
+	if strings.ContainsAny(strings.TrimSpace(prefix), " \t") {
+		return items
+	}
+
+	for _, keyword := range grammar.Actions {
+		item := CompletionItem{Label: keyword, Kind: completionItemKindKeyword}
+
+		if doc, ok := docs[keyword]; ok {
+			item.Detail = strings.Split(doc.syntax, "\n")[0]
+			item.Documentation = &MarkupContent{Kind: markupKindMarkdown, Value: doc.markdown()}
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// variables returns the names of variables defined by VAR, SECRET, ARG, FOR and the params of DEFINE
+func (d *document) variables() []string {
+	set := map[string]bool{}
+
+	grammar.Walk(d.tokens, func(token grammar.Token, file string) bool {
+		switch node := token.Node.(type) {
+		case grammar.NodeVar:
+			set[node.Key] = true
+		case grammar.NodeArg:
+			set[node.Name] = true
+		case grammar.NodeFor:
+			set[node.Key] = true
+		case grammar.NodeDefine:
+			for _, param := range node.Params {
+				set[param] = true
+			}
+		}
+
+		return true
+	})
+
+	var names []string
+
+	for name := range set {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (d *document) hover(p Position) *Hover {
+	line, offset := d.offset(p)
+
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+
+	start, end := offset, offset
+
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isWord(r) {
+			break
+		}
+		start -= size
+	}
+
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if !isWord(r) {
+			break
+		}
+		end += size
+	}
+
+	doc, ok := docs[line[start:end]]
+
+	if !ok {
+		return nil
+	}
+
+	return &Hover{
+		Contents: MarkupContent{Kind: markupKindMarkdown, Value: doc.markdown()},
+		Range: &Range{
+			Start: Position{Line: p.Line, Character: utf16Length(line[:start])},
+			End:   Position{Line: p.Line, Character: utf16Length(line[:end])},
+		},
+	}
+}
+
+// definition returns the location of VAR or ARG which defines the variable at the position.
+// If the variable is defined many times, the nearest definition above is preferred
+func (d *document) definition(p Position) []Location {
+	name, ok := d.expression(p)
+
+	if !ok {
+		return nil
+	}
+
+	var found, first *grammar.Span
+
+	grammar.Walk(d.tokens, func(token grammar.Token, file string) bool {
+		var span grammar.Span
+
+		switch node := token.Node.(type) {
+		case grammar.NodeVar:
+			if node.Key != name {
+				return true
+			}
+			span = node.Span
+		case grammar.NodeArg:
+			if node.Name != name {
+				return true
+			}
+			span = node.Span
+		default:
+			return true
+		}
+
+		if file != "" {
+			return true
+		}
+
+		if first == nil {
+			first = &span
+		}
+
+		if span.Start.Line-1 <= p.Line {
+			found = &span
+		}
+
+		return true
+	})
+
+	if found == nil {
+		found = first
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	return []Location{{URI: d.uri, Range: d.rangeOf(*found)}}
+}
@@ -0,0 +1,202 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serve sends the requests to server and returns the messages written by server
+func serve(t *testing.T, requests ...string) []map[string]interface{} {
+	var in, out bytes.Buffer
+
+	for _, req := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	}
+
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []map[string]interface{}
+
+	reader := bufio.NewReader(&out)
+
+	for reader.Buffered() > 0 || out.Len() > 0 {
+		body, err := readMessage(reader)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var message map[string]interface{}
+
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatal(err)
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func didOpen(text string) string {
+	b, _ := json.Marshal(text)
+
+	return `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///tmp/.s4","version":1,"text":` + string(b) + `}}}`
+}
+
+func position(method string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":{"textDocument":{"uri":"file:///tmp/.s4"},"position":{"line":%d,"character":%d}}}`, method, line, character)
+}
+
+func TestServerDiagnostics(t *testing.T) {
+	messages := serve(t, didOpen("RUN ls\nFOO bar"), `{"jsonrpc":"2.0","method":"exit"}`)
+
+	if len(messages) != 1 || messages[0]["method"] != "textDocument/publishDiagnostics" {
+		t.Fatalf("messages = %v", messages)
+	}
+
+	diagnostics := messages[0]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v", diagnostics)
+	}
+
+	diagnostic := diagnostics[0].(map[string]interface{})
+	start := diagnostic["range"].(map[string]interface{})["start"]
+
+	if !reflect.DeepEqual(start, map[string]interface{}{"line": 1.0, "character": 0.0}) {
+		t.Errorf("start = %v", start)
+	}
+}
+
+func TestServerCompletion(t *testing.T) {
+	text := "VAR name = s4\nFOR f IN a b\nEND\nDEFINE greet(who)\nEND\nRUN echo {{ \nR"
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      []string
+	}{
+		{
+			name:      "variables",
+			line:      5,
+			character: 12,
+			want:      []string{"f", "name", "who"},
+		},
+		{
+			name:      "keywords",
+			line:      6,
+			character: 1,
+			want:      []string{"CONNECT", "ENV", "VAR"},
+		},
+		{
+			name:      "arguments",
+			line:      5,
+			character: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := serve(t, didOpen(text), position("textDocument/completion", tt.line, tt.character))
+
+			var got []string
+
+			for _, item := range messages[1]["result"].([]interface{}) {
+				got = append(got, item.(map[string]interface{})["label"].(string))
+			}
+
+			if len(got) > len(tt.want) {
+				got = got[:len(tt.want)]
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completion = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerHover(t *testing.T) {
+	messages := serve(t, didOpen("CONNECT root@localhost:22\nRUN ls"), position("textDocument/hover", 1, 1), position("textDocument/hover", 1, 5), position("textDocument/hover", 0, 1))
+
+	contents := messages[1]["result"].(map[string]interface{})["contents"].(map[string]interface{})
+
+	if !strings.Contains(contents["value"].(string), "RUN <command>") {
+		t.Errorf("hover = %v", contents["value"])
+	}
+
+	if messages[2]["result"] != nil {
+		t.Errorf("hover = %v, want nil", messages[2]["result"])
+	}
+
+	contents = messages[3]["result"].(map[string]interface{})["contents"].(map[string]interface{})
+
+	if !strings.Contains(contents["value"].(string), "WITH FILE <private_key_file>") {
+		t.Errorf("hover = %v", contents["value"])
+	}
+}
+
+func TestServerDefinition(t *testing.T) {
+	text := "VAR name = a\nRUN LOCAL echo {{ name }}\nVAR name = b\nRUN LOCAL echo {{name|upper}} {{ other }}"
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      interface{}
+	}{
+		{
+			name:      "definition",
+			line:      1,
+			character: 19,
+			want:      0.0,
+		},
+		{
+			name:      "nearest definition",
+			line:      3,
+			character: 17,
+			want:      2.0,
+		},
+		{
+			name:      "undefined",
+			line:      3,
+			character: 34,
+		},
+		{
+			name:      "not in template",
+			line:      3,
+			character: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := serve(t, didOpen(text), position("textDocument/definition", tt.line, tt.character))
+
+			var got interface{}
+
+			if locations, ok := messages[1]["result"].([]interface{}); ok && len(locations) > 0 {
+				got = locations[0].(map[string]interface{})["range"].(map[string]interface{})["start"].(map[string]interface{})["line"]
+			}
+
+			if got != tt.want {
+				t.Errorf("definition = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerMethodNotFound(t *testing.T) {
+	messages := serve(t, `{"jsonrpc":"2.0","id":1,"method":"foo"}`)
+
+	if e, ok := messages[0]["error"].(map[string]interface{}); !ok || e["code"] != float64(codeMethodNotFound) {
+		t.Errorf("messages = %v", messages)
+	}
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/variable"
+	"github.com/mattn/go-isatty"
+)
+
+// SetVariables sets the variables from command line. They are defined before any step runs, and satisfy the ARGs
+func (r *Runner) SetVariables(vars map[string]string) {
+	for key, value := range vars {
+		r.variable[key] = value
+	}
+}
+
+// resolveArgs sets the value of ARGs before running, so the missing ARGs are reported before connecting to the server.
+// The value is from command line, the default value, or the prompt if it is running in terminal
+func (r *Runner) resolveArgs() error {
+	var (
+		args    []grammar.NodeArg
+		missing []string
+	)
+
+	// ARG is only allowed at the top level of file, but the file may be included in the blocks. eg. IF, TASK or DEFINE
+	grammar.Walk(r.tokens, func(token grammar.Token, file string) bool {
+		if node, ok := token.Node.(grammar.NodeArg); ok {
+			args = append(args, node)
+		}
+
+		return true
+	})
+
+	interactive := isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+
+	for _, arg := range args {
+		if _, ok := r.variable[arg.Name]; ok {
+			continue
+		}
+
+		switch {
+		case arg.Default != nil:
+			// the default value can refer to the ARGs before
+			value, err := variable.Compile(*arg.Default, r.variable)
+
+			// it may refer to the missing ARGs, which are reported later
+			if err != nil && len(missing) > 0 {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			r.variable[arg.Name] = value
+		case interactive:
+			var value string
+
+			prompt := &survey.Input{
+				Message: fmt.Sprintf("Please type the value of `%s`", arg.Name),
+			}
+
+			if err := survey.AskOne(prompt, &value, survey.WithValidator(survey.Required)); err != nil {
+				return err
+			}
+
+			r.variable[arg.Name] = value
+		default:
+			missing = append(missing, arg.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing the required `%s` `%s`, pass it with `--var %s=<value>`", grammar.ActionARG, strings.Join(missing, "`, `"), missing[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArgInNestedInclude(t *testing.T) {
+	content := `IF a == a
+  INCLUDE ./common.s4
+END
+TASK deploy
+  INCLUDE ./deploy.s4
+END
+`
+
+	newRunner := func(t *testing.T) (*Runner, *syncBuffer) {
+		dir := t.TempDir()
+
+		files := map[string]string{
+			".s4":       content,
+			"common.s4": "ARG NAME\nRUN LOCAL echo name={{NAME}}\n",
+			"deploy.s4": "ARG ENV = prod\nRUN LOCAL echo env={{ENV}}\n",
+		}
+
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r, err := NewRunner(filepath.Join(dir, ".s4"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := &syncBuffer{}
+
+		r.stdout = output
+		r.stderr = output
+
+		return r, output
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		r, _ := newRunner(t)
+
+		if err := r.RunTask("deploy"); err == nil || !strings.Contains(err.Error(), "missing the required `ARG` `NAME`") {
+			t.Errorf("RunTask() error = %v, want the error of missing ARG", err)
+		}
+	})
+
+	t.Run("passed", func(t *testing.T) {
+		r, output := newRunner(t)
+
+		r.SetVariables(map[string]string{"NAME": "s4"})
+
+		if err := r.RunTask("deploy"); err != nil {
+			t.Fatalf("RunTask() error = %v", err)
+		}
+
+		for _, want := range []string{"name=s4\n", "env=prod\n"} {
+			if !strings.Contains(output.String(), want) {
+				t.Errorf("RunTask() output does not contain %q:\n%s", want, output)
+			}
+		}
+	})
+}
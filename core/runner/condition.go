@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/ssh"
+	"github.com/axetroy/s4/core/variable"
+	"github.com/fatih/color"
+)
+
+func (r *Runner) actionIf(params grammar.NodeIf) error {
+	r.nextStep(grammar.ActionIF, color.YellowString(params.SourceCode))
+
+	ok, _, err := r.evaluateCondition(params.Condition)
+
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		fmt.Fprintf(r.stdout, "Condition is %s\n", color.GreenString("true"))
+		err := r.runTokens(params.Then)
+		// the steps of ELSE are after THEN
+		r.currentStep += countSteps(params.Else)
+		return err
+	}
+
+	fmt.Fprintf(r.stdout, "Condition is %s\n", color.YellowString("false"))
+	r.currentStep += countSteps(params.Then)
+	return r.runTokens(params.Else)
+}
+
+func (r *Runner) actionAssert(params grammar.NodeAssert) error {
+	r.nextStep(grammar.ActionASSERT, color.YellowString(params.SourceCode))
+
+	ok, reason, err := r.evaluateCondition(params.Condition)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("`%s %s` failed, %s", grammar.ActionASSERT, params.SourceCode, reason)
+	}
+
+	fmt.Fprintf(r.stdout, "Assertion is %s\n", color.GreenString("true"))
+
+	return nil
+}
+
+// evaluateCondition returns the result of condition, and the reason which describes the actual state. eg. `1.4.1` == `1.4.2`
+func (r *Runner) evaluateCondition(condition grammar.NodeCondition) (bool, string, error) {
+	var (
+		result bool
+		reason string
+		err    error
+	)
+
+	switch {
+	case condition.Compare != nil:
+		operands, err := variable.CompileArray([]string{condition.Compare.Left, condition.Compare.Right}, r.variable)
+
+		if err != nil {
+			return false, "", err
+		}
+
+		left, right := operands[0], operands[1]
+
+		switch condition.Compare.Operator {
+		case grammar.OperatorEqual:
+			result = left == right
+		case grammar.OperatorNotEqual:
+			result = left != right
+		default:
+			return false, "", fmt.Errorf("invalid operator `%s`", condition.Compare.Operator)
+		}
+
+		reason = fmt.Sprintf("got `%s` %s `%s`", left, condition.Compare.Operator, right)
+	case condition.Exists != nil:
+		if err = r.requireConnection(); err != nil {
+			return false, "", err
+		}
+
+		filepath, err := variable.Compile(condition.Exists.Path, r.variable)
+
+		if err != nil {
+			return false, "", err
+		}
+
+		filepath = r.resolveRemotePath(filepath)
+
+		if result, err = r.ssh.Exists(filepath); err != nil {
+			return false, "", err
+		}
+
+		if result {
+			reason = fmt.Sprintf("remote file `%s` exists", filepath)
+		} else {
+			reason = fmt.Sprintf("remote file `%s` does not exist", filepath)
+		}
+	case condition.Command != nil:
+		succeed, stdout, err := r.commandSucceed(*condition.Command)
+
+		if err != nil {
+			return false, "", err
+		}
+
+		result = succeed
+
+		if succeed {
+			reason = "the command exited with status 0"
+		} else {
+			reason = "the command exited with non-zero status"
+		}
+
+		if succeed && condition.Contains != nil {
+			text, err := variable.Compile(*condition.Contains, r.variable)
+
+			if err != nil {
+				return false, "", err
+			}
+
+			if result = strings.Contains(stdout, text); result {
+				reason = fmt.Sprintf("the output contains `%s`", text)
+			} else {
+				reason = fmt.Sprintf("the output does not contain `%s`", text)
+			}
+		}
+	default:
+		return false, "", errors.New("invalid condition")
+	}
+
+	if condition.Not {
+		result = !result
+	}
+
+	return result, reason, nil
+}
+
+// commandSucceed runs the command and reports whether it exits with status 0, the stdout is returned as well
+func (r *Runner) commandSucceed(cmd grammar.NodeRunCommand) (bool, string, error) {
+	if cmd.RunInLocal {
+		var c *exec.Cmd
+
+		if cmd.Script != "" {
+			script, err := variable.Compile(cmd.Script, r.variable)
+
+			if err != nil {
+				return false, "", err
+			}
+
+			c = r.shellCommand(script)
+		} else {
+			commandArr, err := variable.CompileArray(cmd.Command, r.variable)
+
+			if err != nil {
+				return false, "", err
+			}
+
+			c = exec.CommandContext(r.ctx, commandArr[0], commandArr[1:]...)
+		}
+
+		var stdout bytes.Buffer
+
+		c.Stdout = r.output(r.stdout, &stdout)
+		c.Stderr = r.output(r.stderr, nil)
+
+		if err := r.runCommand(c); err != nil {
+			var exitError *exec.ExitError
+			if errors.As(err, &exitError) {
+				return false, stdout.String(), nil
+			}
+			return false, "", err
+		}
+
+		return true, stdout.String(), nil
+	}
+
+	if err := r.requireConnection(); err != nil {
+		return false, "", err
+	}
+
+	command, err := variable.Compile(cmd.SourceCode, r.variable)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	stdout, _, err := r.ssh.Run(command, r.sshOptions())
+
+	if err != nil {
+		if ssh.IsExitError(err) {
+			return false, stdout.String(), nil
+		}
+		return false, "", err
+	}
+
+	return true, stdout.String(), nil
+}
@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIfSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		want      []string
+	}{
+		{
+			name:      "then",
+			condition: "a == a",
+			want:      []string{"Step 1/5: IF a == a\n", "Step 2/5: RUN LOCAL echo then\n", "Step 5/5: RUN LOCAL echo after\n"},
+		},
+		{
+			name:      "else",
+			condition: "a == b",
+			want:      []string{"Step 1/5: IF a == b\n", "Step 3/5: RUN LOCAL echo else1\n", "Step 4/5: RUN LOCAL echo else2\n", "Step 5/5: RUN LOCAL echo after\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, output := newTestRunner(t, `IF `+tt.condition+`
+  RUN LOCAL echo then
+ELSE
+  RUN LOCAL echo else1
+  RUN LOCAL echo else2
+END
+RUN LOCAL echo after
+`)
+
+			if err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			got := stripColor(output.String())
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Run() output does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
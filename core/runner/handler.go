@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/fatih/color"
+)
+
+// the variables which are available in `ON FAILURE`
+const (
+	variableFailedStep = "FAILED_STEP" // the step which fails. eg. `RUN ./deploy.sh`
+	variableError      = "ERROR"       // the message of error
+)
+
+// handler is the steps of `ON FAILURE` or `FINALLY`, and the file where it is defined
+type handler struct {
+	file string
+	body []grammar.Token
+}
+
+// findHandlers collects the handlers at the top level, including the top level of the included files. They run in the order of definition
+func findHandlers(root string, tokens []grammar.Token) (onFailure []handler, finally []handler) {
+	grammar.Walk(tokens, func(token grammar.Token, file string) bool {
+		if file == "" {
+			file = root
+		}
+
+		switch node := token.Node.(type) {
+		case grammar.NodeOnFailure:
+			onFailure = append(onFailure, handler{file: file, body: node.Body})
+		case grammar.NodeFinally:
+			finally = append(finally, handler{file: file, body: node.Body})
+		case grammar.NodeInclude:
+			return true
+		}
+
+		return false
+	})
+
+	return onFailure, finally
+}
+
+// runHandlers runs the handlers after the workflow. The handlers are not limited by the timeout of workflow,
+// so they can clean up after it times out. All the handlers run even if one of them fails, the first error is returned
+func (r *Runner) runHandlers(title string, handlers []handler) error {
+	r.ctx = context.Background()
+
+	var first error
+
+	for _, h := range handlers {
+		fmt.Fprintf(r.stdout, "%s\n", color.CyanString(title))
+
+		// the steps of handler are counted when it runs
+		r.totalStep += countSteps(h.body)
+
+		if err := r.runTokensIn(h.file, h.body); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// finish runs `ON FAILURE` if the workflow fails, then `FINALLY`. The error of workflow is returned if it fails,
+// the errors of handlers are printed, otherwise the error of `FINALLY` is returned
+func (r *Runner) finish(err error) error {
+	onFailure, finally := findHandlers(r.configFile, r.tokens)
+
+	// the steps after the failed step are skipped, they are not counted
+	if err != nil {
+		r.totalStep = r.currentStep - 1
+	}
+
+	if err != nil && len(onFailure) > 0 {
+		r.variable[variableFailedStep] = r.step
+		r.variable[variableError] = stripColor(r.mask(err.Error()))
+
+		if e := r.runHandlers(grammar.ActionON+" "+grammar.KeywordFAILURE, onFailure); e != nil {
+			fmt.Fprintf(r.stderr, "%s\n", color.RedString("`%s %s` failed: %s", grammar.ActionON, grammar.KeywordFAILURE, r.mask(e.Error())))
+		}
+	}
+
+	if len(finally) == 0 {
+		return err
+	}
+
+	e := r.runHandlers(grammar.ActionFINALLY, finally)
+
+	if e == nil {
+		return err
+	}
+
+	if err == nil {
+		return e
+	}
+
+	fmt.Fprintf(r.stderr, "%s\n", color.RedString("`%s` failed: %s", grammar.ActionFINALLY, r.mask(e.Error())))
+
+	return err
+}
@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandlersOnFailure(t *testing.T) {
+	r, output := newTestRunner(t, `FINALLY
+  RUN LOCAL echo finally
+END
+ON FAILURE
+  RUN LOCAL echo "step="{{ FAILED_STEP | quote }}
+  RUN LOCAL echo "error="{{ ERROR | quote }}
+END
+RUN LOCAL echo first
+RUN LOCAL [ '$HOME' = x ]
+RUN LOCAL echo never
+`)
+
+	err := r.Run()
+
+	if err == nil {
+		t.Fatal("Run() error = nil, want the error of the failed step")
+	}
+
+	if want := "RUN LOCAL [ '$HOME' = x ]"; r.variable[variableFailedStep] != want {
+		t.Errorf("FAILED_STEP = %q, want %q", r.variable[variableFailedStep], want)
+	}
+
+	if r.variable[variableError] != err.Error() {
+		t.Errorf("ERROR = %q, want %q", r.variable[variableError], err.Error())
+	}
+
+	got := stripColor(output.String())
+
+	// the values are passed to shell as they are
+	for _, want := range []string{"first\n", "step=RUN LOCAL [ '$HOME' = x ]\n", "error=" + err.Error() + "\n", "finally\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "never") {
+		t.Errorf("Run() runs the step after the failed step:\n%s", got)
+	}
+
+	// `ON FAILURE` runs before `FINALLY`, no matter the order of definition
+	if strings.Index(got, "ON FAILURE") > strings.Index(got, "FINALLY") {
+		t.Errorf("Run() runs `FINALLY` before `ON FAILURE`:\n%s", got)
+	}
+}
+
+func TestHandlersOnSuccess(t *testing.T) {
+	r, output := newTestRunner(t, `ON FAILURE
+  RUN LOCAL echo on-failure
+END
+FINALLY
+  RUN LOCAL echo finally
+END
+RUN LOCAL echo first
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := stripColor(output.String())
+
+	if strings.Contains(got, "on-failure") {
+		t.Errorf("Run() runs `ON FAILURE` after the workflow succeeds:\n%s", got)
+	}
+
+	for _, want := range []string{"first\n", "Step 2/2: RUN LOCAL echo finally\n", "finally\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestHandlersFailed(t *testing.T) {
+	r, output := newTestRunner(t, `ON FAILURE
+  RUN LOCAL exit 4
+END
+FINALLY
+  RUN LOCAL echo finally
+END
+RUN LOCAL exit 3
+`)
+
+	// the workflow fails with the original error, the error of `ON FAILURE` is printed
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("Run() error = %v, want the error of the failed step", err)
+	}
+
+	got := stripColor(output.String())
+
+	for _, want := range []string{"`ON FAILURE` failed:", "exit status 4", "finally\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFinallyFailed(t *testing.T) {
+	r, _ := newTestRunner(t, `FINALLY
+  RUN LOCAL exit 4
+END
+RUN LOCAL echo first
+`)
+
+	// the workflow succeeds, the error of `FINALLY` is returned
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "exit status 4") {
+		t.Errorf("Run() error = %v, want the error of `FINALLY`", err)
+	}
+}
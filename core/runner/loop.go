@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/variable"
+	"github.com/fatih/color"
+)
+
+// countIterations returns the iterations of loop before it runs.
+// The lines of command output are unknown, so it is counted as one iteration
+func countIterations(params grammar.NodeFor) int {
+	if params.Command != nil {
+		return 1
+	}
+
+	return len(params.Items)
+}
+
+func (r *Runner) actionFor(params grammar.NodeFor) error {
+	r.nextStep(grammar.ActionFOR, color.YellowString(params.SourceCode))
+
+	var items []string
+
+	if params.Command != nil {
+		output, err := r.commandOutput(*params.Command, false)
+
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				items = append(items, line)
+			}
+		}
+	} else {
+		compiled, err := variable.CompileArray(params.Items, r.variable)
+
+		if err != nil {
+			return err
+		}
+
+		items = compiled
+	}
+
+	steps := countSteps(params.Body)
+
+	// correct the total step with the actual iterations
+	r.totalStep += steps * (len(items) - countIterations(params))
+
+	if len(items) == 0 {
+		fmt.Fprintln(r.stdout, "Nothing to iterate")
+		return nil
+	}
+
+	// the loop variable only lives in the loop
+	previous, exist := r.variable[params.Key]
+
+	defer func() {
+		if exist {
+			r.variable[params.Key] = previous
+		} else {
+			delete(r.variable, params.Key)
+		}
+	}()
+
+	for i, item := range items {
+		fmt.Fprintf(r.stdout, "%s %s = %s (%d/%d)\n", grammar.ActionFOR, params.Key, color.GreenString(r.mask(item)), i+1, len(items))
+
+		r.variable[params.Key] = item
+
+		if err := r.runTokens(params.Body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/variable"
+	"github.com/fatih/color"
+)
+
+func (r *Runner) actionCall(params grammar.NodeCall) error {
+	r.nextStep(grammar.ActionCALL, color.YellowString(params.SourceCode))
+
+	macro, ok := r.macros[params.Name]
+
+	if !ok {
+		return fmt.Errorf("undefined macro `%s`", params.Name)
+	}
+
+	if len(params.Args) != len(macro.Params) {
+		return fmt.Errorf("macro `%s` expect %d arguments but got %d", params.Name, len(macro.Params), len(params.Args))
+	}
+
+	args, err := variable.CompileArray(params.Args, r.variable)
+
+	if err != nil {
+		return err
+	}
+
+	r.totalStep += countSteps(macro.Body)
+
+	// the variables defined in macro only live in the call
+	scope := map[string]string{}
+
+	for key, value := range r.variable {
+		scope[key] = value
+	}
+
+	for i, param := range macro.Params {
+		scope[param] = args[i]
+	}
+
+	global := r.variable
+	r.variable = scope
+
+	defer func() {
+		r.variable = global
+	}()
+
+	return r.runTokensIn(r.files[grammar.ActionDEFINE+" "+params.Name], macro.Body)
+}
@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/fatih/color"
+)
+
+// prefixWriter writes the output of a branch line by line with the prefix, so the lines of branches are not mixed
+type prefixWriter struct {
+	mu     *sync.Mutex // shared by the writers of branches
+	output io.Writer
+	prefix string
+	line   bytes.Buffer // the incomplete line
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.line.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.line.Bytes(), '\n')
+
+		if i < 0 {
+			break
+		}
+
+		if _, err := io.WriteString(w.output, w.prefix+string(w.line.Next(i+1))); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the incomplete line
+func (w *prefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.line.Len() == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w.output, w.prefix+w.line.String()+"\n")
+
+	w.line.Reset()
+
+	return err
+}
+
+// fork returns the runner of a branch of PARALLEL. The variables and the working directories are copied,
+// so the branches do not change each other. The connection is shared.
+// The steps are numbered in each branch, because the branches run at the same time
+func (r *Runner) fork(ctx context.Context, token grammar.Token, stdout, stderr io.Writer) *Runner {
+	branch := *r
+
+	branch.ctx = ctx
+	branch.currentStep = 1
+	branch.totalStep = countSteps([]grammar.Token{token})
+	branch.stdout = stdout
+	branch.stderr = stderr
+	branch.branch = true
+	branch.env = map[string]string{}
+	branch.variable = map[string]string{}
+	branch.secrets = append([]string{}, r.secrets...)
+
+	for key, value := range r.env {
+		branch.env[key] = value
+	}
+
+	for key, value := range r.variable {
+		branch.variable[key] = value
+	}
+
+	return &branch
+}
+
+// actionParallel runs the steps concurrently, each step is a branch. The other branches are stopped if a branch fails
+func (r *Runner) actionParallel(params grammar.NodeParallel) error {
+	r.nextStep(grammar.ActionPARALLEL, color.YellowString("%d steps", len(params.Body)))
+
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		once     sync.Once
+		failed   = -1 // the branch which fails first
+		branches = make([]*Runner, len(params.Body))
+		writers  = make([]*prefixWriter, 0, len(params.Body)*2)
+		errs     = make([]error, len(params.Body))
+	)
+
+	for i, token := range params.Body {
+		prefix := color.CyanString("[%d] ", i+1)
+		stdout := &prefixWriter{mu: &mu, output: r.stdout, prefix: prefix}
+		stderr := &prefixWriter{mu: &mu, output: r.stderr, prefix: prefix}
+
+		writers = append(writers, stdout, stderr)
+		branches[i] = r.fork(ctx, token, stdout, stderr)
+	}
+
+	for i, token := range params.Body {
+		wg.Add(1)
+
+		go func(i int, token grammar.Token) {
+			defer wg.Done()
+
+			if errs[i] = branches[i].runTokens([]grammar.Token{token}); errs[i] != nil {
+				once.Do(func() {
+					failed = i
+					cancel()
+				})
+			}
+		}(i, token)
+	}
+
+	wg.Wait()
+
+	for _, w := range writers {
+		_ = w.Flush()
+	}
+
+	// the secrets defined in branches, eg. by the macros, are still masked after PARALLEL
+	secrets := len(r.secrets)
+
+	for _, branch := range branches {
+		for _, secret := range branch.secrets[secrets:] {
+			r.addSecret(secret)
+		}
+	}
+
+	if failed < 0 {
+		return nil
+	}
+
+	r.step = branches[failed].step
+
+	return fmt.Errorf("[%d] %s", failed+1, errs[failed])
+}
@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		output syncBuffer
+		wg     sync.WaitGroup
+	)
+
+	a := &prefixWriter{mu: &mu, output: &output, prefix: "[1] "}
+	b := &prefixWriter{mu: &mu, output: &output, prefix: "[2] "}
+
+	for _, w := range []*prefixWriter{a, b} {
+		wg.Add(1)
+
+		go func(w *prefixWriter) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				_, _ = w.Write([]byte("hel"))
+				_, _ = w.Write([]byte("lo\nwor"))
+				_, _ = w.Write([]byte("ld\n"))
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	_, _ = a.Write([]byte("no newline"))
+
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+
+	if len(lines) != 401 {
+		t.Fatalf("prefixWriter wrote %d lines, want 401", len(lines))
+	}
+
+	for _, line := range lines[:400] {
+		// the lines of writers are not mixed
+		if line != "[1] hello" && line != "[1] world" && line != "[2] hello" && line != "[2] world" {
+			t.Errorf("prefixWriter wrote the line %q", line)
+		}
+	}
+
+	if want := "[1] no newline"; lines[400] != want {
+		t.Errorf("Flush() wrote %q, want %q", lines[400], want)
+	}
+}
+
+func TestFork(t *testing.T) {
+	r := &Runner{
+		env:      map[string]string{"A": "1"},
+		variable: map[string]string{"name": "s4"},
+		secrets:  []string{"hunter2"},
+		stdout:   &syncBuffer{},
+		stderr:   &syncBuffer{},
+		ctx:      context.Background(),
+	}
+
+	token := grammar.Token{
+		Key: grammar.ActionIF,
+		Node: grammar.NodeIf{
+			Then: []grammar.Token{{Key: grammar.ActionRUN, Node: grammar.NodeRun{}}},
+			Else: []grammar.Token{{Key: grammar.ActionRUN, Node: grammar.NodeRun{}}},
+		},
+	}
+
+	output := &syncBuffer{}
+	branch := r.fork(context.Background(), token, output, output)
+
+	if !branch.branch || branch.stdout != output || branch.stderr != output {
+		t.Errorf("fork() does not run in branch with its output")
+	}
+
+	if branch.currentStep != 1 || branch.totalStep != 3 {
+		t.Errorf("fork() step = %d/%d, want 1/3", branch.currentStep, branch.totalStep)
+	}
+
+	branch.env["A"] = "2"
+	branch.variable["name"] = "branch"
+	branch.addSecret("secret")
+
+	if r.env["A"] != "1" || r.variable["name"] != "s4" || len(r.secrets) != 1 {
+		t.Errorf("the branch changes the runner: env = %v, variable = %v, secrets = %v", r.env, r.variable, r.secrets)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	r, output := newTestRunner(t, `PARALLEL
+  RUN LOCAL echo one
+  RUN LOCAL echo two && echo three
+END
+RUN LOCAL echo after
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := stripColor(output.String())
+
+	for _, want := range []string{"Step 1/2: PARALLEL 2 steps\n", "[1] Step 1/1: RUN LOCAL echo one\n", "[1] one\n", "[2] two\n", "[2] three\n", "Step 2/2: RUN LOCAL echo after\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestParallelFailure(t *testing.T) {
+	r, output := newTestRunner(t, `PARALLEL
+  RUN LOCAL sleep 10
+  IF a == a
+    RUN LOCAL echo first
+    RUN LOCAL exit 3
+  END
+END
+RUN LOCAL echo never
+`)
+
+	start := time.Now()
+	err := r.Run()
+
+	if err == nil || !strings.HasPrefix(err.Error(), "[2] ") {
+		t.Fatalf("Run() error = %v, want the error of the 2nd branch", err)
+	}
+
+	// the other branch is stopped
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Run() takes %s, the other branch is not stopped", d)
+	}
+
+	if want := "RUN LOCAL exit 3"; r.step != want {
+		t.Errorf("the failed step = %q, want %q", r.step, want)
+	}
+
+	if got := output.String(); strings.Contains(got, "never") {
+		t.Errorf("Run() runs the step after the failed PARALLEL:\n%s", got)
+	}
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/fatih/color"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// actionRetry runs the step again if it fails, until it succeeds or the attempts run out
+func (r *Runner) actionRetry(params grammar.NodeRetry) error {
+	interval := params.Interval
+
+	for attempt := 1; ; attempt++ {
+		// the step is counted once, no matter how many times it runs
+		currentStep, totalStep := r.currentStep, r.totalStep
+
+		err := r.runToken(params.Step)
+
+		// the workflow or the step times out, it is not retried
+		if err == nil || attempt >= params.Times || r.ctx.Err() != nil {
+			return err
+		}
+
+		delay := interval
+
+		if params.Jitter {
+			delay = jitter(delay)
+		}
+
+		fmt.Fprintf(r.stdout, "%s, retry in %s\n", color.YellowString("Attempt %d/%d failed: %s", attempt, params.Times, r.mask(err.Error())), delay.Round(time.Millisecond))
+
+		if err := r.sleep(delay); err != nil {
+			return err
+		}
+
+		interval = time.Duration(float64(interval) * params.Backoff)
+		r.currentStep, r.totalStep = currentStep, totalStep
+	}
+}
+
+// jitter returns a random duration between the half and the whole of duration
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubSleep records the durations of sleep instead of waiting
+func stubSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+
+	var delays []time.Duration
+
+	original := sleep
+
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+
+	t.Cleanup(func() {
+		sleep = original
+	})
+
+	return &delays
+}
+
+func TestRetry(t *testing.T) {
+	delays := stubSleep(t)
+	count := filepath.Join(t.TempDir(), "count")
+
+	// the command succeeds at the 3rd attempt
+	r, output := newTestRunner(t, `RETRY 5 EVERY 1s BACKOFF RUN LOCAL echo x >> `+count+` && [ $(wc -l < `+count+`) -ge 3 ]
+RUN LOCAL echo done
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(*delays, want) {
+		t.Errorf("RETRY sleeps %v, want %v", *delays, want)
+	}
+
+	got := stripColor(output.String())
+
+	for _, want := range []string{"Attempt 1/5 failed", "retry in 1s\n", "Attempt 2/5 failed", "retry in 2s\n", "Step 2/2: RUN LOCAL echo done\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "Attempt 3/5") {
+		t.Errorf("RETRY runs the step after it succeeds:\n%s", got)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	delays := stubSleep(t)
+
+	r, output := newTestRunner(t, `RETRY 4 EVERY 2s BACKOFF 1.5 RUN LOCAL echo attempt && exit 3
+RUN LOCAL echo never
+`)
+
+	if err := r.Run(); err == nil {
+		t.Fatal("Run() error = nil, want the error of the last attempt")
+	}
+
+	if want := []time.Duration{2 * time.Second, 3 * time.Second, 4500 * time.Millisecond}; !reflect.DeepEqual(*delays, want) {
+		t.Errorf("RETRY sleeps %v, want %v", *delays, want)
+	}
+
+	got := stripColor(output.String())
+
+	if n := strings.Count(got, "attempt\n"); n != 4 {
+		t.Errorf("RETRY runs the step %d times, want 4:\n%s", n, got)
+	}
+
+	// the step is counted once
+	if n := strings.Count(got, "Step 1/2: RUN LOCAL echo attempt && exit 3\n"); n != 4 {
+		t.Errorf("RETRY prints the step %d times as step 1/2, want 4:\n%s", n, got)
+	}
+
+	if strings.Contains(got, "never") || strings.Contains(got, "Attempt 4/4") {
+		t.Errorf("Run() continues after the last attempt:\n%s", got)
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	delays := stubSleep(t)
+
+	r, _ := newTestRunner(t, `RETRY 5 EVERY 4s BACKOFF JITTER RUN LOCAL exit 1`)
+
+	if err := r.Run(); err == nil {
+		t.Fatal("Run() error = nil, want the error of the last attempt")
+	}
+
+	if len(*delays) != 4 {
+		t.Fatalf("RETRY sleeps %d times, want 4", len(*delays))
+	}
+
+	// the jitter does not change the backoff of the next attempt
+	interval := 4 * time.Second
+
+	for i, d := range *delays {
+		if d < interval/2 || d > interval {
+			t.Errorf("the delay of attempt %d = %s, want between %s and %s", i+1, d, interval/2, interval)
+		}
+
+		interval *= 2
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 2, 3, time.Millisecond, time.Second, time.Hour} {
+		for i := 0; i < 1000; i++ {
+			if got := jitter(d); got < d/2 || got > d {
+				t.Fatalf("jitter(%s) = %s, want between %s and %s", d, got, d/2, d)
+			}
+		}
+	}
+}
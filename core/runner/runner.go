@@ -2,12 +2,15 @@ package runner
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,14 +23,25 @@ import (
 )
 
 type Runner struct {
-	ssh         *ssh.Client       // current ssh client
-	totalStep   int               // total step
-	currentStep int               // current step
-	cwdLocal    string            // current working dir at local
-	tokens      []grammar.Token   // token from parsing
-	cwdRemote   string            // current remote working dir
-	env         map[string]string // env for remote
-	variable    map[string]string // var
+	ssh         *ssh.Client                   // current ssh client
+	totalStep   int                           // total step
+	currentStep int                           // current step
+	cwdLocal    string                        // current working dir at local
+	tokens      []grammar.Token               // token from parsing
+	cwdRemote   string                        // current remote working dir
+	env         map[string]string             // env for remote
+	variable    map[string]string             // var
+	macros      map[string]grammar.NodeDefine // macros defined by DEFINE
+	configFile  string                        // the s4 file
+	file        string                        // the file of current step
+	files       map[string]string             // the files where the tasks and macros are defined
+	secrets     []string                      // the values of SECRET, they are masked in the output
+	ctx         context.Context               // it is done when the workflow or the step times out
+	timeout     time.Duration                 // the timeout of workflow, 0 means no limit
+	step        string                        // the running step, it is named in the timeout error
+	stdout      io.Writer                     // the output of steps, it is prefixed in the branch of PARALLEL
+	stderr      io.Writer                     // the error output of steps
+	branch      bool                          // the runner runs a branch of PARALLEL
 }
 
 func NewRunner(configFilePath string) (*Runner, error) {
@@ -43,13 +57,7 @@ func NewRunner(configFilePath string) (*Runner, error) {
 
 	fmt.Printf("Load the s4 file `%s`.\n", color.GreenString(configFilePath))
 
-	content, err := ioutil.ReadFile(configFilePath)
-
-	if err != nil {
-		return nil, err
-	}
-
-	tokens, err := grammar.Tokenizer(string(content))
+	tokens, err := grammar.ParseFile(configFilePath)
 
 	if err != nil {
 		return nil, err
@@ -57,10 +65,15 @@ func NewRunner(configFilePath string) (*Runner, error) {
 
 	return &Runner{
 		currentStep: 1,
-		totalStep:   len(tokens),
+		totalStep:   countSteps(tokens),
 		tokens:      tokens,
+		configFile:  configFilePath,
+		file:        configFilePath,
 		env:         map[string]string{},
 		variable:    map[string]string{},
+		ctx:         context.Background(),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
 	}, nil
 }
 
@@ -108,8 +121,21 @@ func (r *Runner) resolveRemotePaths(remotePaths []string) []string {
 	return paths
 }
 
+// sshOptions returns the options of remote command, it runs in the working directory with the ENV
+func (r *Runner) sshOptions() ssh.Options {
+	return ssh.Options{
+		CWD:     r.cwdRemote,
+		Env:     r.env,
+		Secrets: r.secrets,
+		Context: r.ctx,
+		Stdout:  r.stdout,
+		Stderr:  r.stderr,
+	}
+}
+
 func (r *Runner) nextStep(action string, msg string) {
-	fmt.Printf("Step %d/%d: %s %s\n", r.currentStep, r.totalStep, strings.ToUpper(action), msg)
+	fmt.Fprintf(r.stdout, "Step %d/%d: %s %s\n", r.currentStep, r.totalStep, strings.ToUpper(action), r.mask(msg))
+	r.step = stripColor(fmt.Sprintf("%s %s", strings.ToUpper(action), r.mask(msg)))
 	r.currentStep++
 }
 
@@ -121,67 +147,285 @@ func printTimeDiff(d1 time.Time, d2 time.Time) {
 	fmt.Println(color.GreenString(fmt.Sprintf("Finish in %ss.", fmt.Sprintf("%f", diffSecond))))
 }
 
+// countSteps counts the steps of tokens, including the steps in blocks
+func countSteps(tokens []grammar.Token) int {
+	count := 0
+
+	for _, token := range tokens {
+		switch node := token.Node.(type) {
+		case grammar.NodeInclude:
+			// the steps of the included file are spliced in, INCLUDE itself is not a step
+			count += countSteps(node.Body)
+			continue
+		case grammar.NodeTask:
+			// the steps of task are counted when the task runs
+			continue
+		case grammar.NodeDefine:
+			// the steps of macro are counted when it is called
+			continue
+		case grammar.NodeArg:
+			// the ARGs are resolved before running
+			continue
+		case grammar.NodeOnFailure, grammar.NodeFinally:
+			// the steps of handlers are counted when they run
+			continue
+		case grammar.NodeRetry:
+			// the step is counted once, no matter how many times it runs
+			count += countSteps([]grammar.Token{node.Step})
+			continue
+		case grammar.NodeTimeout:
+			count += countSteps([]grammar.Token{node.Step})
+			continue
+		case grammar.NodeParallel:
+			// the steps of branches are numbered in each branch
+		case grammar.NodeIf:
+			count += countSteps(node.Then) + countSteps(node.Else)
+		case grammar.NodeFor:
+			count += countSteps(node.Body) * countIterations(node)
+		}
+
+		count++
+	}
+
+	return count
+}
+
+// Tasks returns the tasks defined in the s4 file
+func (r *Runner) Tasks() ([]grammar.NodeTask, error) {
+	return grammar.FindTasks(r.tokens)
+}
+
+// Run runs the steps outside of tasks, then the `default` task and its dependencies if it is defined
 func (r *Runner) Run() error {
+	tasks, err := r.Tasks()
+
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if task.Name == grammar.DefaultTask {
+			return r.RunTask(grammar.DefaultTask)
+		}
+	}
+
+	return r.run(nil)
+}
+
+// RunTask runs the steps outside of tasks, then the task and its dependencies
+func (r *Runner) RunTask(name string) error {
+	tasks, err := grammar.ResolveTask(r.tokens, name)
+
+	if err != nil {
+		return err
+	}
+
+	return r.run(tasks)
+}
+
+func (r *Runner) run(tasks []grammar.NodeTask) error {
 	defer func() {
 		if r.ssh != nil {
 			_ = r.ssh.Disconnect()
 		}
 	}()
 
+	macros, err := grammar.FindMacros(r.configFile, r.tokens)
+
+	if err != nil {
+		return err
+	}
+
+	r.macros = macros
+	r.files = definitionFiles(r.configFile, r.tokens)
+
+	if err := r.resolveArgs(); err != nil {
+		return err
+	}
+
+	r.totalStep = countSteps(r.tokens)
+
+	for _, task := range tasks {
+		r.totalStep += countSteps(task.Body)
+	}
+
 	d1 := time.Now()
 
-	for _, action := range r.tokens {
-		var err error
-		switch action.Key {
-		case grammar.ActionCONNECT:
-			err = r.actionConnect(action.Node.(grammar.NodeConnect))
-			break
-		case grammar.ActionVAR:
-			err = r.actionVar(action.Node.(grammar.NodeVar))
-			break
-		case grammar.ActionENV:
-			err = r.actionEnv(action.Node.(grammar.NodeEnv))
-			break
-		case grammar.ActionCD:
-			err = r.actionCd(action.Node.(grammar.NodeCd))
-			break
-		case grammar.ActionTRY:
-			fallthrough
-		case grammar.ActionRUN:
-			err = r.actionRun(action.Node.(grammar.NodeRun))
-			break
-		case grammar.ActionMOVE:
-			err = r.actionMove(action.Node.(grammar.NodeCopy))
-			break
-		case grammar.ActionCOPY:
-			err = r.actionCopy(action.Node.(grammar.NodeCopy))
-			break
-		case grammar.ActionDELETE:
-			err = r.actionDelete(action.Node.(grammar.NodeDelete))
-			break
-		case grammar.ActionUPLOAD:
-			err = r.actionUpload(action.Node.(grammar.NodeUpload))
-			break
-		case grammar.ActionDOWNLOAD:
-			err = r.actionDownload(action.Node.(grammar.NodeUpload))
-			break
-		default:
-			err = fmt.Errorf("invalid action `%s`", action.Key)
-		}
+	if r.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
 
-		if err != nil {
-			printTimeDiff(d1, time.Now())
-			return err
-		}
+		r.ctx = ctx
+	}
+
+	err = r.runTokens(r.tokens)
+
+	for i := 0; err == nil && i < len(tasks); i++ {
+		fmt.Fprintf(r.stdout, "Task %s\n", color.CyanString(tasks[i].Name))
+		err = r.runTokensIn(r.files[grammar.ActionTASK+" "+tasks[i].Name], tasks[i].Body)
 	}
 
+	if err != nil && r.ctx.Err() != nil {
+		err = &timeoutError{step: r.step, timeout: r.timeout}
+	}
+
+	err = r.finish(err)
+
 	printTimeDiff(d1, time.Now())
 
+	return r.maskError(err)
+}
+
+func (r *Runner) runTokens(tokens []grammar.Token) error {
+	for _, action := range tokens {
+		// the step which can not be stopped, eg. UPLOAD, may finish after the timeout
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := r.runToken(action); err != nil {
+			return r.locate(action, err)
+		}
+	}
+
 	return nil
 }
 
+// runTokensIn runs the tokens which are defined in the file
+func (r *Runner) runTokensIn(file string, tokens []grammar.Token) error {
+	previous := r.file
+	r.file = file
+
+	defer func() {
+		r.file = previous
+	}()
+
+	return r.runTokens(tokens)
+}
+
+// locate adds the location of step to the error of template, so it is easy to find the wrong variable
+func (r *Runner) locate(action grammar.Token, err error) error {
+	var templateErr *variable.Error
+
+	if !errors.As(err, &templateErr) || templateErr.Location != "" {
+		return err
+	}
+
+	if node, ok := action.Node.(grammar.Locatable); ok {
+		templateErr.Location = fmt.Sprintf("%s:%s", r.file, node.Location().Start)
+	}
+
+	return err
+}
+
+// definitionFiles returns the files where the tasks and macros are defined. eg. {"TASK deploy": "deploy.s4"}
+func definitionFiles(root string, tokens []grammar.Token) map[string]string {
+	files := map[string]string{}
+
+	grammar.Walk(tokens, func(token grammar.Token, file string) bool {
+		if file == "" {
+			file = root
+		}
+
+		switch node := token.Node.(type) {
+		case grammar.NodeTask:
+			files[grammar.ActionTASK+" "+node.Name] = file
+		case grammar.NodeDefine:
+			files[grammar.ActionDEFINE+" "+node.Name] = file
+		case grammar.NodeInclude:
+			return true
+		}
+
+		return false
+	})
+
+	return files
+}
+
+func (r *Runner) runToken(action grammar.Token) error {
+	switch action.Key {
+	case grammar.ActionCONNECT:
+		return r.actionConnect(action.Node.(grammar.NodeConnect))
+	case grammar.ActionVAR, grammar.ActionSECRET:
+		return r.actionVar(action.Key, action.Node.(grammar.NodeVar))
+	case grammar.ActionENV:
+		return r.actionEnv(action.Node.(grammar.NodeEnv))
+	case grammar.ActionENVFILE, grammar.ActionVARFILE:
+		return r.actionEnvFile(action.Key, action.Node.(grammar.NodeEnvFile))
+	case grammar.ActionCD:
+		return r.actionCd(action.Node.(grammar.NodeCd))
+	case grammar.ActionTRY, grammar.ActionRUN, grammar.ActionLOCAL:
+		return r.actionRun(action.Key, action.Node.(grammar.NodeRun))
+	case grammar.ActionMOVE:
+		return r.actionMove(action.Node.(grammar.NodeCopy))
+	case grammar.ActionCOPY:
+		return r.actionCopy(action.Node.(grammar.NodeCopy))
+	case grammar.ActionDELETE:
+		return r.actionDelete(action.Node.(grammar.NodeDelete))
+	case grammar.ActionUPLOAD:
+		return r.actionUpload(action.Node.(grammar.NodeUpload))
+	case grammar.ActionDOWNLOAD:
+		return r.actionDownload(action.Node.(grammar.NodeUpload))
+	case grammar.ActionIF:
+		return r.actionIf(action.Node.(grammar.NodeIf))
+	case grammar.ActionASSERT:
+		return r.actionAssert(action.Node.(grammar.NodeAssert))
+	case grammar.ActionRETRY:
+		return r.actionRetry(action.Node.(grammar.NodeRetry))
+	case grammar.ActionWAIT:
+		return r.actionWait(action.Node.(grammar.NodeWait))
+	case grammar.ActionTIMEOUT:
+		return r.actionTimeout(action.Node.(grammar.NodeTimeout))
+	case grammar.ActionPARALLEL:
+		return r.actionParallel(action.Node.(grammar.NodeParallel))
+	case grammar.ActionFOR:
+		return r.actionFor(action.Node.(grammar.NodeFor))
+	case grammar.ActionINCLUDE:
+		include := action.Node.(grammar.NodeInclude)
+		return r.runTokensIn(include.File, include.Body)
+	case grammar.ActionTASK:
+		// task is only a definition, it runs by name
+		return nil
+	case grammar.ActionDEFINE:
+		// macro is only a definition, it runs by CALL
+		return nil
+	case grammar.ActionARG:
+		// the ARGs have been resolved before running
+		return nil
+	case grammar.ActionON, grammar.ActionFINALLY:
+		// the handlers run after the workflow
+		return nil
+	case grammar.ActionCALL:
+		return r.actionCall(action.Node.(grammar.NodeCall))
+	default:
+		return fmt.Errorf("invalid action `%s`", action.Key)
+	}
+}
+
 func (r *Runner) actionConnect(params grammar.NodeConnect) error {
-	r.nextStep(grammar.ActionCONNECT, color.GreenString(fmt.Sprintf("%s@%s:%s", params.Username, params.Host, params.Port)))
+	// the address may be templates. eg. `{{USER}}@{{HOST}}:22`
+	address, err := variable.CompileArray([]string{params.Username, params.Host, params.Port}, r.variable)
+
+	if err != nil {
+		address = []string{params.Username, params.Host, params.Port}
+	}
+
+	username, hostname, port := address[0], address[1], address[2]
+
+	r.nextStep(grammar.ActionCONNECT, color.GreenString(fmt.Sprintf("%s@%s:%s", username, hostname, port)))
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := strconv.Atoi(port); err != nil {
+		return fmt.Errorf("invalid port `%s`", port)
+	}
+
+	// the connection is shared by the branches
+	if r.branch {
+		return fmt.Errorf("`%s` can not run in `%s`", grammar.ActionCONNECT, grammar.ActionPARALLEL)
+	}
 
 	// if ssh client exist. disconnect first
 	if r.ssh != nil {
@@ -197,12 +441,25 @@ func (r *Runner) actionConnect(params grammar.NodeConnect) error {
 	if params.ConnectType != nil {
 		switch *params.ConnectType {
 		case host.ConnectTypePassword:
-			s := variable.Compile(*params.Password, r.variable)
+			s, err := variable.Compile(*params.Password, r.variable)
+
+			if err != nil {
+				return err
+			}
+
+			// the password is masked like SECRET
+			r.addSecret(s)
+
 			password = &s
 			privateKey = nil
 			break
 		case host.ConnectTypePrivateKeyFile:
-			privateKeyFilePath := variable.Compile(*params.Password, r.variable)
+			privateKeyFilePath, err := variable.Compile(*params.Password, r.variable)
+
+			if err != nil {
+				return err
+			}
+
 			b, err := ioutil.ReadFile(privateKeyFilePath)
 
 			if err != nil {
@@ -230,7 +487,7 @@ func (r *Runner) actionConnect(params grammar.NodeConnect) error {
 
 	r.ssh = ssh.NewSSH()
 
-	if err := r.ssh.Connect(params.Host, params.Port, params.Username, password, privateKey); err != nil {
+	if err := r.ssh.Connect(hostname, port, username, password, privateKey); err != nil {
 		r.ssh = nil
 		return err
 	}
@@ -259,7 +516,11 @@ func (r *Runner) actionCd(params grammar.NodeCd) error {
 
 	r.nextStep(grammar.ActionCD, color.GreenString(dir))
 
-	targetPath := variable.Compile(dir, r.variable)
+	targetPath, err := variable.Compile(dir, r.variable)
+
+	if err != nil {
+		return err
+	}
 
 	r.cwdRemote = r.resolveRemotePath(targetPath)
 
@@ -283,8 +544,15 @@ func (r *Runner) actionCopy(params grammar.NodeCopy) error {
 		return err
 	}
 
-	sourceFilepath = variable.Compile(sourceFilepath, r.variable)
-	destinationFilepath = variable.Compile(destinationFilepath, r.variable)
+	var err error
+
+	if sourceFilepath, err = variable.Compile(sourceFilepath, r.variable); err != nil {
+		return err
+	}
+
+	if destinationFilepath, err = variable.Compile(destinationFilepath, r.variable); err != nil {
+		return err
+	}
 
 	sourceFilepath = r.resolveRemotePath(sourceFilepath)
 	destinationFilepath = r.resolveRemotePath(destinationFilepath)
@@ -302,11 +570,15 @@ func (r *Runner) actionDelete(params grammar.NodeDelete) error {
 
 	r.nextStep(grammar.ActionDELETE, color.YellowString(strings.Join(params.Targets, ", ")))
 
-	args := variable.CompileArray(params.Targets, r.variable)
+	args, err := variable.CompileArray(params.Targets, r.variable)
+
+	if err != nil {
+		return err
+	}
 
 	files := r.resolveRemotePaths(args)
 
-	if err := r.ssh.Delete(files...); err != nil {
+	if err := r.ssh.Delete(r.stdout, files...); err != nil {
 		return err
 	}
 
@@ -330,14 +602,21 @@ func (r *Runner) actionDownload(params grammar.NodeUpload) error {
 		return err
 	}
 
-	sourceFiles = variable.CompileArray(sourceFiles, r.variable)
-	destinationDir = variable.Compile(destinationDir, r.variable)
+	var err error
+
+	if sourceFiles, err = variable.CompileArray(sourceFiles, r.variable); err != nil {
+		return err
+	}
+
+	if destinationDir, err = variable.Compile(destinationDir, r.variable); err != nil {
+		return err
+	}
 
 	sourceFiles = r.resolveRemotePaths(sourceFiles)
 	destinationDir = r.resolveLocalPath(destinationDir)
 
 	for _, filePath := range sourceFiles {
-		if err := r.ssh.Download(filePath, destinationDir); err != nil {
+		if err := r.ssh.Download(filePath, destinationDir, r.stdout); err != nil {
 			return err
 		}
 	}
@@ -362,8 +641,15 @@ func (r *Runner) actionMove(params grammar.NodeCopy) error {
 		return err
 	}
 
-	sourceFilepath = variable.Compile(sourceFilepath, r.variable)
-	destinationFilepath = variable.Compile(destinationFilepath, r.variable)
+	var err error
+
+	if sourceFilepath, err = variable.Compile(sourceFilepath, r.variable); err != nil {
+		return err
+	}
+
+	if destinationFilepath, err = variable.Compile(destinationFilepath, r.variable); err != nil {
+		return err
+	}
 
 	sourceFilepath = r.resolveRemotePath(sourceFilepath)
 	destinationFilepath = r.resolveRemotePath(destinationFilepath)
@@ -375,38 +661,45 @@ func (r *Runner) actionMove(params grammar.NodeCopy) error {
 	return nil
 }
 
-func (r *Runner) actionRun(params grammar.NodeRun) error {
-	stepName := grammar.ActionRUN
-
-	if !params.ExitWithCommand {
-		stepName = grammar.ActionTRY
-	}
-
+func (r *Runner) actionRun(stepName string, params grammar.NodeRun) error {
 	r.nextStep(stepName, color.YellowString(params.SourceCode))
 
 	isPipeCommand := len(params.Commands) > 1
 	var lastCommandStdout bytes.Buffer
 
 	for _, cmd := range params.Commands {
-		if cmd.RunInLocal {
-			command := variable.Compile(cmd.Command[0], r.variable)
-			args := variable.CompileArray(cmd.Command[1:], r.variable)
+		if cmd.Script != "" {
+			if err := r.runScript(params, cmd); err != nil {
+				return err
+			}
+		} else if cmd.RunInLocal {
+			commandArr, err := variable.CompileArray(cmd.Command, r.variable)
+
+			if err != nil {
+				return err
+			}
 
-			c := exec.Command(command, args...)
+			c := exec.CommandContext(r.ctx, commandArr[0], commandArr[1:]...)
 
 			c.Stdin = bytes.NewReader(lastCommandStdout.Bytes())
-			c.Stdout = os.Stdout
-			c.Stderr = os.Stderr
+			c.Stdout = r.output(r.stdout, nil)
+			c.Stderr = r.output(r.stderr, nil)
 
-			if err := c.Run(); err != nil {
-				return err
+			if err := r.runCommand(c); err != nil {
+				var exitError *exec.ExitError
+
+				// the command exits with non-zero code, `TRY` moves on like the command of shell
+				if !errors.As(err, &exitError) || r.ctx.Err() != nil {
+					return err
+				}
 			}
 
 			if c.ProcessState.Success() == false {
 				if params.ExitWithCommand {
 					return fmt.Errorf("run command '%v' fail", params.SourceCode)
 				} else {
-					fmt.Printf("`TRY` run command '%v' fail. move on to the next step\n", params.SourceCode)
+					fmt.Fprintln(r.stdout, r.mask(c.ProcessState.String()))
+					fmt.Fprintf(r.stdout, "`TRY` run command '%v' fail. move on to the next step\n", r.mask(params.SourceCode))
 				}
 			}
 		} else {
@@ -414,14 +707,18 @@ func (r *Runner) actionRun(params grammar.NodeRun) error {
 				return err
 			}
 
-			command := variable.Compile(cmd.SourceCode, r.variable)
+			command, err := variable.Compile(cmd.SourceCode, r.variable)
+
+			if err != nil {
+				return err
+			}
 
-			if stdout, _, err := r.ssh.Run(command, ssh.Options{CWD: r.cwdRemote, Env: r.env}); err != nil {
+			if stdout, _, err := r.ssh.Run(command, r.sshOptions()); err != nil {
 				if params.ExitWithCommand {
 					return err
 				} else {
-					fmt.Println(err.Error())
-					fmt.Printf("`TRY` run command '%v' fail. move on to the next step\n", params.SourceCode)
+					fmt.Fprintln(r.stdout, r.mask(err.Error()))
+					fmt.Fprintf(r.stdout, "`TRY` run command '%v' fail. move on to the next step\n", r.mask(params.SourceCode))
 				}
 			} else {
 				if isPipeCommand {
@@ -434,6 +731,45 @@ func (r *Runner) actionRun(params grammar.NodeRun) error {
 	return nil
 }
 
+// runScript runs the script with the shell of local or remote. eg. heredoc or the command of LOCAL
+func (r *Runner) runScript(params grammar.NodeRun, cmd grammar.NodeRunCommand) error {
+	script := cmd.Script
+
+	var err error
+
+	if !cmd.Verbatim {
+		if script, err = variable.Compile(script, r.variable); err != nil {
+			return err
+		}
+	}
+
+	if cmd.RunInLocal {
+		c := r.shellCommand(script)
+
+		c.Stdout = r.output(r.stdout, nil)
+		c.Stderr = r.output(r.stderr, nil)
+
+		err = r.runCommand(c)
+	} else {
+		if err := r.requireConnection(); err != nil {
+			return err
+		}
+
+		_, _, err = r.ssh.RunScript(script, r.sshOptions())
+	}
+
+	if err != nil {
+		if params.ExitWithCommand {
+			return err
+		}
+
+		fmt.Fprintln(r.stdout, r.mask(err.Error()))
+		fmt.Fprintf(r.stdout, "`TRY` run command '%v' fail. move on to the next step\n", r.mask(params.SourceCode))
+	}
+
+	return nil
+}
+
 func (r *Runner) actionUpload(params grammar.NodeUpload) error {
 	sourceFiles := params.SourceFiles
 	destinationDir := params.DestinationDir
@@ -451,14 +787,21 @@ func (r *Runner) actionUpload(params grammar.NodeUpload) error {
 		return err
 	}
 
-	sourceFiles = variable.CompileArray(sourceFiles, r.variable)
-	destinationDir = variable.Compile(destinationDir, r.variable)
+	var err error
+
+	if sourceFiles, err = variable.CompileArray(sourceFiles, r.variable); err != nil {
+		return err
+	}
+
+	if destinationDir, err = variable.Compile(destinationDir, r.variable); err != nil {
+		return err
+	}
 
 	sourceFiles = r.resolveLocalPaths(sourceFiles)
 	destinationDir = r.resolveRemotePath(destinationDir)
 
 	for _, filePath := range sourceFiles {
-		if err := r.ssh.Upload(filePath, destinationDir); err != nil {
+		if err := r.ssh.Upload(filePath, destinationDir, r.stdout); err != nil {
 			return err
 		}
 	}
@@ -468,71 +811,175 @@ func (r *Runner) actionUpload(params grammar.NodeUpload) error {
 
 func (r *Runner) actionEnv(params grammar.NodeEnv) error {
 	r.nextStep(grammar.ActionENV, color.GreenString(params.SourceCode))
-	r.env[params.Key] = variable.Compile(params.Value, r.variable)
+
+	value, err := variable.Compile(params.Value, r.variable)
+
+	if err != nil {
+		return err
+	}
+
+	r.env[params.Key] = value
 	return nil
 }
 
-func (r *Runner) actionVar(params grammar.NodeVar) error {
-	r.nextStep(grammar.ActionVAR, color.GreenString(params.SourceCode))
+func (r *Runner) actionEnvFile(stepName string, params grammar.NodeEnvFile) error {
+	r.nextStep(stepName, color.GreenString(params.SourceCode))
+
+	filePath, err := variable.Compile(params.Path, r.variable)
+
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+
+	if params.Remote {
+		if err := r.requireConnection(); err != nil {
+			return err
+		}
+
+		content, err = r.ssh.ReadFile(r.resolveRemotePath(filePath))
+	} else {
+		content, err = ioutil.ReadFile(r.resolveLocalPath(filePath))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	vars, err := variable.ParseEnvFile(string(content))
+
+	if err != nil {
+		return fmt.Errorf("invalid env file `%s`: %s", filePath, err)
+	}
+
+	target := r.env
+
+	if stepName == grammar.ActionVARFILE {
+		target = r.variable
+	}
+
+	for key, value := range vars {
+		target[key] = value
+	}
+
+	return nil
+}
+
+func (r *Runner) actionVar(stepName string, params grammar.NodeVar) error {
+	msg := params.SourceCode
+
+	// the value of literal is not printed in the step, the source of it may differ from the value. eg. the quoted value with escapes
+	if params.Secret && params.Literal != nil {
+		r.addSecret(params.Literal.Value)
+
+		if v, err := variable.Parse(params.SourceCode); err == nil {
+			r.addSecret(v.Value)
+
+			if raw := v.Value; len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+				r.addSecret(raw[1 : len(raw)-1])
+			}
+		}
+
+		msg = params.Key + " = " + variable.MaskText
+	}
+
+	r.nextStep(stepName, color.GreenString(msg))
 
 	if params.Literal != nil {
 		r.variable[params.Key] = params.Literal.Value
 	} else if params.Env != nil {
+		key, err := variable.Compile(params.Env.Key, r.variable)
+
+		if err != nil {
+			return err
+		}
+
 		if params.Env.Local {
-			r.variable[params.Key] = os.Getenv(variable.Compile(params.Env.Key, r.variable))
+			r.variable[params.Key] = os.Getenv(key)
 		} else {
 			if err := r.requireConnection(); err != nil {
 				return err
 			}
-			if remoteEnvValue, err := r.ssh.Env(variable.Compile(params.Env.Key, r.variable), ssh.Options{Env: r.env}); err != nil {
+			if remoteEnvValue, err := r.ssh.Env(key, ssh.Options{Env: r.env, Context: r.ctx}); err != nil {
 				return err
 			} else {
 				r.variable[params.Key] = remoteEnvValue
 			}
 		}
 	} else if params.Command != nil {
-		if params.Command.Local {
-			commandArr := variable.CompileArray(params.Command.Command, r.variable)
+		output, err := r.commandOutput(*params.Command, params.Secret)
 
-			command := commandArr[0]
-			args := commandArr[1:]
+		if err != nil {
+			return err
+		}
 
-			c := exec.Command(command, args...)
+		if output, err = variable.Extract(output, params.Command.Extract); err != nil {
+			return err
+		}
 
-			var stdoutBuf bytes.Buffer
-			var stderrBuf bytes.Buffer
+		r.variable[params.Key] = output
+	}
 
-			c.Stdout = &stdoutBuf
-			c.Stderr = &stderrBuf
+	if params.Secret && params.Literal == nil {
+		r.addSecret(r.variable[params.Key])
+	}
 
-			if err := c.Run(); err != nil {
-				return err
-			}
+	return nil
+}
 
-			if c.ProcessState.Success() == false {
-				return fmt.Errorf("run command '%s' fail", params.Command.Command)
-			}
+// commandOutput runs the command at local or remote and returns the trimmed stdout. The stdout of remote is not printed if it is quiet
+func (r *Runner) commandOutput(cmd grammar.NodeVarCommand, quiet bool) (string, error) {
+	if cmd.Local {
+		commandArr, err := variable.CompileArray(cmd.Command, r.variable)
 
-			r.variable[params.Key] = strings.TrimSpace(stdoutBuf.String())
+		if err != nil {
+			return "", err
+		}
+
+		var c *exec.Cmd
+
+		if cmd.Shell {
+			c = r.shellCommand(strings.Join(commandArr, " "))
 		} else {
-			if err := r.requireConnection(); err != nil {
-				return err
-			}
+			c = exec.CommandContext(r.ctx, commandArr[0], commandArr[1:]...)
+		}
 
-			stdout, _, err := r.ssh.Run(strings.Join(params.Command.Command, " "), ssh.Options{
-				CWD: r.cwdRemote,
-				Env: r.env,
-			})
+		var stdoutBuf bytes.Buffer
+		var stderrBuf bytes.Buffer
 
-			if err != nil {
-				return err
-			}
+		c.Stdout = &stdoutBuf
+		c.Stderr = &stderrBuf
 
-			output := stdout.String()
+		if err := r.runCommand(c); err != nil {
+			return "", err
+		}
 
-			r.variable[params.Key] = strings.TrimSpace(output)
+		if c.ProcessState.Success() == false {
+			return "", fmt.Errorf("run command '%s' fail", cmd.Command)
 		}
+
+		return strings.TrimSpace(stdoutBuf.String()), nil
 	}
 
-	return nil
+	if err := r.requireConnection(); err != nil {
+		return "", err
+	}
+
+	command, err := variable.Compile(strings.Join(cmd.Command, " "), r.variable)
+
+	if err != nil {
+		return "", err
+	}
+
+	options := r.sshOptions()
+	options.Quiet = quiet
+
+	stdout, _, err := r.ssh.Run(command, options)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
 }
@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is the output of steps, the commands and the branches of PARALLEL write to it concurrently
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.b.String()
+}
+
+// newTestRunner returns the runner of the s4 file with the content, the output of steps is written to the buffer
+func newTestRunner(t *testing.T, content string) (*Runner, *syncBuffer) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), ".s4")
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRunner(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &syncBuffer{}
+
+	r.stdout = output
+	r.stderr = output
+
+	return r, output
+}
+
+func TestMaskLocalOutput(t *testing.T) {
+	r, output := newTestRunner(t, `SECRET PW = hunter2
+RUN LOCAL echo pw={{PW}}
+RUN LOCAL echo err={{PW}} >&2
+RUN ["echo", "json={{PW}}"]
+RUN LOCAL printf "tail={{PW}}"
+ASSERT RUN LOCAL echo {{PW}} CONTAINS hunter2
+PARALLEL
+  RUN LOCAL echo branch={{PW}}
+END
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := output.String()
+
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("Run() output reveals the secret:\n%s", got)
+	}
+
+	for _, want := range []string{"pw=***\n", "err=***\n", "json=***\n", "tail=***", "[1] branch=***\n"} {
+		if !strings.Contains(stripColor(got), want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestConnectTemplate(t *testing.T) {
+	r, output := newTestRunner(t, `ARG USER
+ARG PORT = 1
+CONNECT {{USER}}@127.0.0.1:{{PORT}} WITH PASSWORD secret
+`)
+
+	r.SetVariables(map[string]string{"USER": "deploy"})
+
+	// nothing listens on the port, the address is rendered before connecting
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("Run() error = %v, want the error of connecting to 127.0.0.1:1", err)
+	}
+
+	if want := "CONNECT deploy@127.0.0.1:1\n"; !strings.Contains(stripColor(output.String()), want) {
+		t.Errorf("Run() output does not contain %q:\n%s", want, output)
+	}
+}
+
+func TestMaskEscapedSecret(t *testing.T) {
+	r, output := newTestRunner(t, `SECRET PW = "p\\ss\"w"
+RUN LOCAL echo '{{PW}}'
+RUN LOCAL echo 'p\\ss\"w'
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := stripColor(output.String())
+
+	for _, secret := range []string{`p\ss"w`, `p\\ss\"w`} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Run() output reveals the secret %q:\n%s", secret, got)
+		}
+	}
+
+	for _, want := range []string{"Step 1/3: SECRET PW = ***\n", "***\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestTryCommandArray(t *testing.T) {
+	r, output := newTestRunner(t, `TRY ["false"]
+RUN LOCAL echo after
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := stripColor(output.String())
+
+	for _, want := range []string{"exit status 1\n", "`TRY` run command '[\"false\"]' fail. move on to the next step\n", "after\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run() output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	r, _ = newTestRunner(t, `RUN ["false"]
+RUN LOCAL echo after
+`)
+
+	if err := r.Run(); err == nil {
+		t.Errorf("Run() error = nil, want the error of RUN")
+	}
+}
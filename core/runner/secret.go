@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"errors"
+
+	"github.com/axetroy/s4/core/variable"
+)
+
+// addSecret masks the value in the output of the following steps
+func (r *Runner) addSecret(value string) {
+	r.secrets = append(r.secrets, value)
+}
+
+// mask replaces the secrets in the text with `***`
+func (r *Runner) mask(text string) string {
+	return variable.Mask(text, r.secrets)
+}
+
+// maskError replaces the secrets in the message of error. The error is kept if it does not contain any secret
+func (r *Runner) maskError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if msg := r.mask(err.Error()); msg != err.Error() {
+		return errors.New(msg)
+	}
+
+	return err
+}
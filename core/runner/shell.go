@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/axetroy/s4/core/ssh"
+)
+
+// shellCommand returns the command which runs the script with the shell of local.
+// It runs with the ENV and in the working directory, like the commands at remote
+func (r *Runner) shellCommand(script string) *exec.Cmd {
+	var c *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(r.ctx, "cmd", "/C", script)
+	} else {
+		c = exec.CommandContext(r.ctx, "sh", "-c", script)
+	}
+
+	c.Dir = r.cwdLocal
+	c.Env = os.Environ()
+
+	for key, value := range r.env {
+		c.Env = append(c.Env, key+"="+value)
+	}
+
+	return c
+}
+
+// output returns the writer of local command, the secrets are masked line by line as the output of remote command.
+// The data receives the output without masking if it is not nil. The output is kept as it is if there is no secret,
+// so the command still writes to the terminal, eg. with colors
+func (r *Runner) output(w io.Writer, data *bytes.Buffer) io.Writer {
+	if len(r.secrets) > 0 {
+		return ssh.NewWriter(w, data, r.secrets)
+	}
+
+	if data != nil {
+		return io.MultiWriter(w, data)
+	}
+
+	return w
+}
+
+// runCommand runs the local command. The output which is not a file is copied by the runner instead of exec,
+// so it returns when the command is killed by timeout, even if the children of shell still hold the output
+func (r *Runner) runCommand(c *exec.Cmd) error {
+	var (
+		copies sync.WaitGroup
+		pipes  []*os.File
+	)
+
+	pipe := func(w io.Writer) (io.Writer, error) {
+		if _, ok := w.(*os.File); ok || w == nil {
+			return w, nil
+		}
+
+		reader, writer, err := os.Pipe()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipes = append(pipes, writer)
+		copies.Add(1)
+
+		go func() {
+			defer copies.Done()
+			_, _ = io.Copy(w, reader)
+			_ = reader.Close()
+
+			// the incomplete line of masking writer
+			if f, ok := w.(interface{ Flush() error }); ok {
+				_ = f.Flush()
+			}
+		}()
+
+		return writer, nil
+	}
+
+	var err error
+
+	if c.Stdout, err = pipe(c.Stdout); err == nil {
+		c.Stderr, err = pipe(c.Stderr)
+	}
+
+	if err == nil {
+		err = c.Start()
+	}
+
+	// the write ends are held by the command
+	for _, p := range pipes {
+		_ = p.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = c.Wait()
+
+	if r.ctx.Err() == nil {
+		copies.Wait()
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/axetroy/s4/core/grammar"
+)
+
+// colorReg matches the color codes of terminal
+var colorReg = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// timeoutError is the error of the step which does not finish in time
+type timeoutError struct {
+	step    string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("`%s` timed out after %s", e.step, e.timeout)
+}
+
+// SetTimeout sets the timeout of workflow. The running step is stopped and the workflow fails if it does not finish in time
+func (r *Runner) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// actionTimeout runs the step, it is stopped and fails if it does not finish in the duration
+func (r *Runner) actionTimeout(params grammar.NodeTimeout) error {
+	parent := r.ctx
+
+	ctx, cancel := context.WithTimeout(parent, params.Timeout)
+
+	defer cancel()
+
+	r.ctx = ctx
+
+	defer func() {
+		r.ctx = parent
+	}()
+
+	err := r.runToken(params.Step)
+
+	// the timeout of workflow is reported by the workflow
+	if parent.Err() != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return &timeoutError{step: r.step, timeout: params.Timeout}
+	}
+
+	return err
+}
+
+// sleep pauses until the duration passes or the context is done. It is replaced in tests, so they do not wait
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sleep pauses the workflow for the duration, it returns early with error if the workflow or the step times out
+func (r *Runner) sleep(d time.Duration) error {
+	return sleep(r.ctx, d)
+}
+
+// stripColor removes the color codes, so the text is plain in the error
+func stripColor(s string) string {
+	return colorReg.ReplaceAllString(s, "")
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStepTimeout(t *testing.T) {
+	r, output := newTestRunner(t, `TIMEOUT 200ms RUN LOCAL sleep 10
+RUN LOCAL echo never
+`)
+
+	start := time.Now()
+	err := r.Run()
+
+	if want := "`RUN LOCAL sleep 10` timed out after 200ms"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Run() error = %v, want %q", err, want)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Run() takes %s, the command is not stopped", d)
+	}
+
+	if got := output.String(); strings.Contains(got, "never") {
+		t.Errorf("Run() runs the step after the timeout:\n%s", got)
+	}
+}
+
+func TestStepTimeoutInTime(t *testing.T) {
+	r, output := newTestRunner(t, `TIMEOUT 10s RUN LOCAL echo fast
+RUN LOCAL echo after
+`)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := output.String(); !strings.Contains(got, "fast\n") || !strings.Contains(got, "after\n") {
+		t.Errorf("Run() does not run the steps:\n%s", got)
+	}
+}
+
+func TestWorkflowTimeout(t *testing.T) {
+	r, output := newTestRunner(t, `RUN LOCAL echo first
+RUN LOCAL sleep 10
+RUN LOCAL echo never
+`)
+
+	r.SetTimeout(300 * time.Millisecond)
+
+	start := time.Now()
+	err := r.Run()
+
+	if want := "`RUN LOCAL sleep 10` timed out after 300ms"; err == nil || err.Error() != want {
+		t.Fatalf("Run() error = %v, want %q", err, want)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Run() takes %s, the command is not stopped", d)
+	}
+
+	got := output.String()
+
+	if !strings.Contains(got, "first\n") || strings.Contains(got, "never") {
+		t.Errorf("Run() output = %q, want the steps before the timeout only", got)
+	}
+}
+
+func TestWorkflowTimeoutInStepTimeout(t *testing.T) {
+	r, _ := newTestRunner(t, `TIMEOUT 10s RUN LOCAL sleep 10`)
+
+	r.SetTimeout(200 * time.Millisecond)
+
+	// the workflow times out before the step, it is reported by the workflow
+	if err, want := r.Run(), "`RUN LOCAL sleep 10` timed out after 200ms"; err == nil || err.Error() != want {
+		t.Errorf("Run() error = %v, want %q", err, want)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	r, output := newTestRunner(t, `TIMEOUT 300ms RETRY 5 EVERY 10s RUN LOCAL exit 1`)
+
+	start := time.Now()
+
+	// the sleep between attempts is stopped by the timeout
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "timed out after 300ms") {
+		t.Errorf("Run() error = %v, want the timeout error", err)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Run() takes %s, the sleep is not stopped", d)
+	}
+
+	if got := output.String(); strings.Contains(got, "Attempt 2/5") {
+		t.Errorf("RETRY runs the step after the timeout:\n%s", got)
+	}
+}
@@ -0,0 +1,308 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/axetroy/s4/core/grammar"
+	"github.com/axetroy/s4/core/variable"
+	"github.com/fatih/color"
+)
+
+// the timeout of each check, so a check does not take the time of others
+const waitCheckTimeout = 5 * time.Second
+
+// waitCheck checks the condition once. The reason describes why it is not ready
+type waitCheck func() (ready bool, reason string, err error)
+
+func (r *Runner) actionWait(params grammar.NodeWait) error {
+	r.nextStep(grammar.ActionWAIT, color.YellowString(params.SourceCode))
+
+	if params.Remote {
+		if err := r.requireConnection(); err != nil {
+			return err
+		}
+	}
+
+	value, err := variable.Compile(params.Value, r.variable)
+
+	if err != nil {
+		return err
+	}
+
+	var check waitCheck
+
+	switch params.Target {
+	case grammar.KeywordPORT:
+		check = r.waitPort(value, params.Remote)
+	case grammar.KeywordHTTP:
+		check, err = r.waitHTTP(value, params.Status, params.Remote)
+	case grammar.KeywordFILE:
+		check = r.waitFile(value, params.Remote)
+	case grammar.KeywordLOG:
+		check, err = r.waitLog(value, params.Pattern, params.Remote)
+	default:
+		err = fmt.Errorf("invalid target `%s`", params.Target)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(params.Timeout)
+
+	for {
+		ready, reason, err := check()
+
+		if err != nil {
+			return err
+		}
+
+		if ready {
+			fmt.Fprintf(r.stdout, "%s is %s\n", params.Target, color.GreenString("ready"))
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+
+		if remaining <= 0 {
+			return fmt.Errorf("`%s %s` timed out after %s, %s", grammar.ActionWAIT, params.SourceCode, params.Timeout, reason)
+		}
+
+		// check at the deadline for the last time
+		if remaining > params.Interval {
+			remaining = params.Interval
+		}
+
+		if err := r.sleep(remaining); err != nil {
+			return err
+		}
+	}
+}
+
+// dial connects to the address from local machine or remote server
+func (r *Runner) dial(network, addr string, remote bool) (net.Conn, error) {
+	if remote {
+		return r.ssh.Dial(network, addr)
+	}
+
+	dialer := net.Dialer{Timeout: waitCheckTimeout}
+
+	return dialer.DialContext(r.ctx, network, addr)
+}
+
+// waitPort checks the port is listening. The host is `localhost` if it is only a port. eg. `8080`, `db:5432`
+func (r *Runner) waitPort(port string, remote bool) waitCheck {
+	addr := port
+
+	if !strings.Contains(addr, ":") {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	return func() (bool, string, error) {
+		conn, err := r.dial("tcp", addr, remote)
+
+		if err != nil {
+			return false, err.Error(), nil
+		}
+
+		_ = conn.Close()
+
+		return true, "", nil
+	}
+}
+
+// waitHTTP checks the url responds with the status. Any 2xx status is expected if the status is 0
+func (r *Runner) waitHTTP(rawURL string, status int, remote bool) (waitCheck, error) {
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url `%s`, expect the url starts with `http://` or `https://`", rawURL)
+	}
+
+	client := &http.Client{
+		Timeout: waitCheckTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return r.dial(network, addr, remote)
+			},
+		},
+	}
+
+	return func() (bool, string, error) {
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, rawURL, nil)
+
+		if err != nil {
+			return false, "", err
+		}
+
+		res, err := client.Do(req)
+
+		if err != nil {
+			return false, err.Error(), nil
+		}
+
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+
+		if (status == 0 && res.StatusCode >= 200 && res.StatusCode < 300) || res.StatusCode == status {
+			return true, "", nil
+		}
+
+		return false, fmt.Sprintf("got status %d", res.StatusCode), nil
+	}, nil
+}
+
+// waitFile checks the file exists
+func (r *Runner) waitFile(filepath string, remote bool) waitCheck {
+	if remote {
+		filepath = r.resolveRemotePath(filepath)
+	} else {
+		filepath = r.resolveLocalPath(filepath)
+	}
+
+	return func() (bool, string, error) {
+		var (
+			exists bool
+			err    error
+		)
+
+		if remote {
+			exists, err = r.ssh.Exists(filepath)
+		} else {
+			if _, err = os.Stat(filepath); err == nil {
+				exists = true
+			} else if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+
+		if err != nil || exists {
+			return exists, "", err
+		}
+
+		return false, fmt.Sprintf("file `%s` does not exist", filepath), nil
+	}
+}
+
+// seekFile is the local or remote file
+type seekFile interface {
+	io.ReadSeeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+func (r *Runner) openFile(filepath string, remote bool) (seekFile, error) {
+	if remote {
+		return r.ssh.Open(r.resolveRemotePath(filepath))
+	}
+
+	return os.Open(r.resolveLocalPath(filepath))
+}
+
+// readFrom reads the file from the offset, and returns the new offset. It reads from the beginning if the file is truncated
+func readFrom(file seekFile, offset int64) ([]byte, int64, error) {
+	info, err := file.Stat()
+
+	if err != nil {
+		return nil, offset, err
+	}
+
+	if info.Size() < offset {
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	b, err := ioutil.ReadAll(file)
+
+	return b, offset + int64(len(b)), err
+}
+
+// waitLog checks the new lines of log match the pattern. The lines before the step are skipped, they may be written by the last run
+func (r *Runner) waitLog(filepath string, pattern string, remote bool) (waitCheck, error) {
+	pattern, err := variable.Compile(pattern, r.variable)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern `%s`: %s", pattern, err)
+	}
+
+	var (
+		offset int64
+		tail   []byte
+	)
+
+	if file, err := r.openFile(filepath, remote); err == nil {
+		if info, err := file.Stat(); err == nil {
+			offset = info.Size()
+		}
+
+		_ = file.Close()
+	}
+
+	return func() (bool, string, error) {
+		file, err := r.openFile(filepath, remote)
+
+		if err != nil {
+			return false, err.Error(), nil
+		}
+
+		defer file.Close()
+
+		b, next, err := readFrom(file, offset)
+
+		if err != nil {
+			return false, err.Error(), nil
+		}
+
+		if next < offset+int64(len(b)) {
+			// the file is truncated, eg. the log is rotated
+			tail = nil
+		}
+
+		offset = next
+
+		var matched bool
+
+		if matched, tail = matchLines(reg, append(tail, b...)); matched {
+			return true, "", nil
+		}
+
+		return false, fmt.Sprintf("the log does not match `%s`", pattern), nil
+	}, nil
+}
+
+// matchLines checks any line of the output matches the pattern, and returns the tail after the last newline.
+// The tail is the line being written, it is read again with the new output of the next check
+func matchLines(reg *regexp.Regexp, output []byte) (bool, []byte) {
+	i := bytes.LastIndexByte(output, '\n')
+
+	if i >= 0 {
+		for _, line := range bytes.Split(output[:i], []byte("\n")) {
+			if reg.Match(bytes.TrimSuffix(line, []byte("\r"))) {
+				return true, nil
+			}
+		}
+	}
+
+	// copy the tail, so the matched lines are not kept by it
+	tail := append([]byte(nil), output[i+1:]...)
+
+	return reg.Match(tail), tail
+}
@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchLines(t *testing.T) {
+	reg := regexp.MustCompile(`^started in \d+ms$`)
+
+	tests := []struct {
+		name     string
+		output   string
+		want     bool
+		wantTail string
+	}{
+		{name: "empty", output: "", want: false, wantTail: ""},
+		{name: "line", output: "starting\r\nstarted in 12ms\n", want: true, wantTail: ""},
+		{name: "no match", output: "starting\nstopped\n", want: false, wantTail: ""},
+		{name: "partial line", output: "starting\nstarted in", want: false, wantTail: "started in"},
+		{name: "tail without newline", output: "starting\nstarted in 12ms", want: true, wantTail: "started in 12ms"},
+		{name: "across lines", output: "started\n in 12ms\n", want: false, wantTail: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, tail := matchLines(reg, []byte(tt.output))
+
+			if got != tt.want {
+				t.Errorf("matchLines() = %v, want %v", got, tt.want)
+			}
+
+			if !got && string(tail) != tt.wantTail {
+				t.Errorf("matchLines() tail = %q, want %q", tail, tt.wantTail)
+			}
+		})
+	}
+}
+
+func TestWaitFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ready")
+
+	r, _ := newTestRunner(t, `WAIT FOR FILE `+file+` ON LOCAL EVERY 50ms TIMEOUT 10s`)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = ioutil.WriteFile(file, nil, 0644)
+	}()
+
+	if err := r.Run(); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ready")
+
+	r, _ := newTestRunner(t, `WAIT FOR FILE `+file+` ON LOCAL EVERY 50ms TIMEOUT 200ms`)
+
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "timed out after 200ms, file `"+file+"` does not exist") {
+		t.Errorf("Run() error = %v, want the timeout error", err)
+	}
+}
+
+func TestWaitLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+
+	if err := ioutil.WriteFile(file, []byte("started in 1ms\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{}
+
+	check, err := r.waitLog(file, `started in \d+ms`, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(s string) {
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer f.Close()
+
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the lines before the step are skipped
+	if ready, _, err := check(); ready || err != nil {
+		t.Fatalf("check() = %v, %v, want not ready", ready, err)
+	}
+
+	write("starting\nstarted ")
+
+	if ready, _, err := check(); ready || err != nil {
+		t.Fatalf("check() = %v, %v, want not ready", ready, err)
+	}
+
+	// the line is matched with the part read by the last check
+	write("in 20ms\n")
+
+	if ready, _, err := check(); !ready || err != nil {
+		t.Fatalf("check() = %v, %v, want ready", ready, err)
+	}
+}
@@ -3,24 +3,35 @@ package ssh
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"strings"
 	"time"
 
+	"github.com/axetroy/s4/core/variable"
 	"github.com/cheggaaa/pb/v3"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
 type Writer struct {
-	output io.Writer
-	data   *bytes.Buffer
+	output  io.Writer
+	data    *bytes.Buffer
+	secrets []string      // the secrets are masked in the output, but kept in the data
+	line    *bytes.Buffer // the incomplete line, a secret may be split into two writes
+}
+
+// NewWriter returns the writer which masks the secrets in the output line by line. The data receives the output without masking if it is not nil
+func NewWriter(output io.Writer, data *bytes.Buffer, secrets []string) Writer {
+	return Writer{output: output, data: data, secrets: secrets, line: &bytes.Buffer{}}
 }
 
 func (w Writer) Write(p []byte) (n int, err error) {
@@ -30,7 +41,33 @@ func (w Writer) Write(p []byte) (n int, err error) {
 		}
 	}
 
-	return w.output.Write(p)
+	if len(w.secrets) == 0 || w.line == nil {
+		return w.output.Write(p)
+	}
+
+	w.line.Write(p)
+
+	// output the complete lines only, the rest is output with the next line or by Flush
+	if i := bytes.LastIndexByte(w.line.Bytes(), '\n'); i >= 0 {
+		if _, err := io.WriteString(w.output, variable.Mask(string(w.line.Next(i+1)), w.secrets)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush outputs the incomplete line
+func (w Writer) Flush() error {
+	if w.line == nil || w.line.Len() == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w.output, variable.Mask(w.line.String(), w.secrets))
+
+	w.line.Reset()
+
+	return err
 }
 
 type Client struct {
@@ -39,10 +76,18 @@ type Client struct {
 }
 
 type Options struct {
-	CWD string            `json:"cwd"`
-	Env map[string]string `json:"env"`
+	CWD     string            `json:"cwd"`
+	Env     map[string]string `json:"env"`
+	Secrets []string          `json:"-"` // the secrets are replaced with `***` in the output
+	Quiet   bool              `json:"-"` // do not print the stdout, eg. the stdout is a secret
+	Context context.Context   `json:"-"` // the remote process is stopped when the context is done, eg. timeout
+	Stdout  io.Writer         `json:"-"` // os.Stdout by default
+	Stderr  io.Writer         `json:"-"` // os.Stderr by default
 }
 
+// killGracePeriod is the time for the remote process to exit after SIGTERM, then it is killed by SIGKILL
+const killGracePeriod = 3 * time.Second
+
 var (
 	// Linux 的内置目录路径，删除这些路径可能会导致系统崩溃
 	// 可以删除他下面的路径，但是不能直接删除目录
@@ -84,12 +129,26 @@ func IsLinuxBuildInPath(filepath string) bool {
 	}
 }
 
+var shellQuoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+
+// quote a string with double quotes for the remote shell, so it can contain spaces. eg. /opt/My App -> "/opt/My App"
+// `$VAR` is still expanded by the shell
+func quote(s string) string {
+	return `"` + shellQuoteReplacer.Replace(s) + `"`
+}
+
+// singleQuote quotes a string with single quotes for the remote shell, nothing is expanded in it.
+// A single quote in the string closes the quotes, is escaped, then the quotes are reopened
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func setEnvForCommand(command string, env map[string]string) (newCommand string) {
 	var setEnvCommand []string
 
 	for key, value := range env {
-		// export KEY=VALUE
-		setEnvCommand = append(setEnvCommand, fmt.Sprintf("export %s=%s;", key, value))
+		// export KEY="VALUE"
+		setEnvCommand = append(setEnvCommand, fmt.Sprintf("export %s=%s;", key, quote(value)))
 	}
 
 	if len(setEnvCommand) != 0 {
@@ -170,6 +229,47 @@ func (c *Client) Disconnect() error {
 	return nil
 }
 
+// IsExitError reports whether the error is caused by the remote command exiting with a non-zero status
+func IsExitError(err error) bool {
+	var exitError *ssh.ExitError
+	return errors.As(err, &exitError)
+}
+
+// Exists checks whether the remote file exists
+func (c *Client) Exists(filepath string) (bool, error) {
+	if _, err := c.sftpClient.Stat(filepath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReadFile reads the content of remote file
+func (c *Client) ReadFile(filepath string) ([]byte, error) {
+	file, err := c.sftpClient.Open(filepath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
+
+// Open opens the remote file for reading
+func (c *Client) Open(filepath string) (*sftp.File, error) {
+	return c.sftpClient.Open(filepath)
+}
+
+// Dial connects to the address from the remote server. eg. `localhost:8080` is the port of remote server
+func (c *Client) Dial(network, addr string) (net.Conn, error) {
+	return c.sshClient.Dial(network, addr)
+}
+
 func (c *Client) Pwd() (string, error) {
 	return c.sftpClient.Getwd()
 }
@@ -194,7 +294,7 @@ func (c *Client) Env(key string, options Options) (string, error) {
 
 	command = setEnvForCommand(command, options.Env)
 
-	if err = session.Run(command); err != nil {
+	if err = runSession(options.Context, session, command); err != nil {
 		return "", err
 	}
 
@@ -211,23 +311,109 @@ func (c *Client) Run(command string, options Options) (stdout bytes.Buffer, stde
 
 	defer session.Close()
 
-	session.Stdout = Writer{output: os.Stdout, data: &stdout}
-	session.Stderr = Writer{output: os.Stderr, data: &stderr}
+	stdoutWriter := NewWriter(os.Stdout, &stdout, options.Secrets)
+	stderrWriter := NewWriter(os.Stderr, &stderr, options.Secrets)
+
+	if options.Stdout != nil {
+		stdoutWriter.output = options.Stdout
+	}
+
+	if options.Stderr != nil {
+		stderrWriter.output = options.Stderr
+	}
+
+	if options.Quiet {
+		stdoutWriter.output = ioutil.Discard
+	}
+
+	defer stdoutWriter.Flush()
+	defer stderrWriter.Flush()
+
+	session.Stdout = stdoutWriter
+	session.Stderr = stderrWriter
 
 	if options.CWD != "" {
-		command = "cd " + options.CWD + " && " + command
+		command = "cd " + quote(options.CWD) + " && " + command
 	}
 
 	command = setEnvForCommand(command, options.Env)
 
-	if err = session.Run(command); err != nil {
+	if err = runSession(options.Context, session, command); err != nil {
 		return
 	}
 
 	return
 }
 
-func (c *Client) downloadFile(remoteFilePath string, localDir string) error {
+// runSession runs the command in the session. When the context is done before the command exits,
+// the remote process is signaled to stop, then the session is closed and the error of context is returned
+func runSession(ctx context.Context, session *ssh.Session, command string) error {
+	if ctx == nil {
+		return session.Run(command)
+	}
+
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// the server may not support the signal, the session is closed anyway so the command does not block the workflow
+	_ = session.Signal(ssh.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(killGracePeriod):
+		_ = session.Signal(ssh.SIGKILL)
+	}
+
+	_ = session.Close()
+
+	return ctx.Err()
+}
+
+// RunScript runs the script with the shell of remote. The script is passed as the argument of shell,
+// so the stdin is not taken by it, the commands which read stdin do not consume the rest of script. eg. `read`, `cat`
+func (c *Client) RunScript(script string, options Options) (stdout bytes.Buffer, stderr bytes.Buffer, err error) {
+	return c.Run("sh -c "+singleQuote(script), options)
+}
+
+// newProgressBar starts the progress bar based on the template. It is only refreshed in terminal,
+// otherwise it is written once when it finishes, so the output is readable in the log or the output of PARALLEL
+func newProgressBar(tmpl string, total int64, output io.Writer) *pb.ProgressBar {
+	bar := pb.New64(total).SetTemplate(pb.ProgressBarTemplate(tmpl))
+
+	bar.Set(pb.Bytes, true)
+	bar.SetWriter(output)
+
+	if f, ok := output.(*os.File); !ok || !isatty.IsTerminal(f.Fd()) {
+		bar.Set(pb.Static, true)
+	}
+
+	return bar.Start()
+}
+
+// finishProgressBar stops the progress bar, the static bar is written with the final state
+func finishProgressBar(bar *pb.ProgressBar, output io.Writer) {
+	bar.Finish()
+
+	if bar.GetBool(pb.Static) {
+		bar.Write()
+		_, _ = io.WriteString(output, "\n")
+	}
+}
+
+func (c *Client) downloadFile(remoteFilePath string, localDir string, output io.Writer) error {
 	remoteFile, err := c.sftpClient.Open(remoteFilePath)
 
 	if err != nil {
@@ -262,11 +448,7 @@ func (c *Client) downloadFile(remoteFilePath string, localDir string) error {
 
 	tmpl := fmt.Sprintf(`{{string . "prefix"}}{{ green "%s" }} {{counters . }} {{ bar . "[" "=" ">" "-" "]"}} {{percent . }} {{speed . }}{{string . "suffix"}}`, localFilePath)
 
-	// start bar based on our template
-	bar := pb.ProgressBarTemplate(tmpl).Start64(remoteFileSize)
-
-	bar.Set(pb.Bytes, true)
-	bar.SetWriter(os.Stdout)
+	bar := newProgressBar(tmpl, remoteFileSize, output)
 
 	barReader := bar.NewProxyReader(remoteFile)
 
@@ -279,12 +461,12 @@ func (c *Client) downloadFile(remoteFilePath string, localDir string) error {
 		return err
 	}
 
-	bar.Finish()
+	finishProgressBar(bar, output)
 
 	return nil
 }
 
-func (c *Client) downloadDir(remoteFilePath string, localDir string) error {
+func (c *Client) downloadDir(remoteFilePath string, localDir string, output io.Writer) error {
 	files, err := c.sftpClient.ReadDir(remoteFilePath)
 	if err != nil {
 		return err
@@ -297,11 +479,11 @@ func (c *Client) downloadDir(remoteFilePath string, localDir string) error {
 		absFilePath := path.Join(remoteFilePath, fileName)
 
 		if file.IsDir() {
-			if err := c.downloadDir(absFilePath, path.Join(localDir, fileName)); err != nil {
+			if err := c.downloadDir(absFilePath, path.Join(localDir, fileName), output); err != nil {
 				return nil
 			}
 		} else {
-			if err := c.downloadFile(absFilePath, localDir); err != nil {
+			if err := c.downloadFile(absFilePath, localDir, output); err != nil {
 				return nil
 			}
 		}
@@ -310,7 +492,8 @@ func (c *Client) downloadDir(remoteFilePath string, localDir string) error {
 	return nil
 }
 
-func (c *Client) Download(remoteFilePath string, localDir string) error {
+// Download downloads the remote file or directory into the local directory, the progress is written to the output
+func (c *Client) Download(remoteFilePath string, localDir string, output io.Writer) error {
 	remoteFileStat, err := c.sftpClient.Stat(remoteFilePath)
 
 	if err != nil {
@@ -319,13 +502,13 @@ func (c *Client) Download(remoteFilePath string, localDir string) error {
 
 	// if it is a directory
 	if remoteFileStat.IsDir() {
-		return c.downloadDir(remoteFilePath, localDir)
+		return c.downloadDir(remoteFilePath, localDir, output)
 	} else {
-		return c.downloadFile(remoteFilePath, localDir)
+		return c.downloadFile(remoteFilePath, localDir, output)
 	}
 }
 
-func (c *Client) uploadFile(localFilePath string, remoteDir string) error {
+func (c *Client) uploadFile(localFilePath string, remoteDir string, output io.Writer) error {
 	localFile, err := os.Open(localFilePath)
 
 	if err != nil {
@@ -364,11 +547,7 @@ func (c *Client) uploadFile(localFilePath string, remoteDir string) error {
 
 	tmpl := fmt.Sprintf(`{{string . "prefix"}}{{ green "%s" }} {{counters . }} {{ bar . "[" "=" ">" "-" "]"}} {{percent . }} {{speed . }}{{string . "suffix"}}`, remoteFilePath)
 
-	// start bar based on our template
-	bar := pb.ProgressBarTemplate(tmpl).Start64(localFileSize)
-
-	bar.Set(pb.Bytes, true)
-	bar.SetWriter(os.Stdout)
+	bar := newProgressBar(tmpl, localFileSize, output)
 
 	localFileReader := bufio.NewReader(localFile)
 
@@ -378,12 +557,12 @@ func (c *Client) uploadFile(localFilePath string, remoteDir string) error {
 		return err
 	}
 
-	bar.Finish()
+	finishProgressBar(bar, output)
 
 	return nil
 }
 
-func (c *Client) uploadDir(localFilePath string, remoteDir string) error {
+func (c *Client) uploadDir(localFilePath string, remoteDir string, output io.Writer) error {
 	files, err := ioutil.ReadDir(localFilePath)
 
 	if err != nil {
@@ -396,11 +575,11 @@ func (c *Client) uploadDir(localFilePath string, remoteDir string) error {
 		fileName := file.Name()
 		absFilePath := path.Join(localFilePath, fileName)
 		if file.IsDir() {
-			if err = c.uploadDir(absFilePath, remoteDir); err != nil {
+			if err = c.uploadDir(absFilePath, remoteDir, output); err != nil {
 				return err
 			}
 		} else {
-			if err := c.uploadFile(absFilePath, remoteDir); err != nil {
+			if err := c.uploadFile(absFilePath, remoteDir, output); err != nil {
 				return err
 			}
 		}
@@ -409,7 +588,8 @@ func (c *Client) uploadDir(localFilePath string, remoteDir string) error {
 	return nil
 }
 
-func (c *Client) Upload(localFilePath string, remoteDir string) error {
+// Upload uploads the local file or directory into the remote directory, the progress is written to the output
+func (c *Client) Upload(localFilePath string, remoteDir string, output io.Writer) error {
 	localStat, err := os.Stat(localFilePath)
 
 	if err != nil {
@@ -417,9 +597,9 @@ func (c *Client) Upload(localFilePath string, remoteDir string) error {
 	}
 
 	if localStat.IsDir() {
-		return c.uploadDir(localFilePath, remoteDir)
+		return c.uploadDir(localFilePath, remoteDir, output)
 	} else {
-		return c.uploadFile(localFilePath, remoteDir)
+		return c.uploadFile(localFilePath, remoteDir, output)
 	}
 }
 
@@ -462,11 +642,12 @@ func (c *Client) Move(oldFilepath string, newFilepath string) error {
 	return c.sftpClient.Rename(oldFilepath, newFilepath)
 }
 
-func (c *Client) Delete(files ...string) error {
+// Delete removes the files, the warnings are written to the output
+func (c *Client) Delete(output io.Writer, files ...string) error {
 	for _, file := range files {
 		// Prevent the removal of dangerous system files
 		if IsLinuxBuildInPath(file) {
-			fmt.Printf("Prevent the removal of dangerous system file '%s'\n", file)
+			fmt.Fprintf(output, "Prevent the removal of dangerous system file '%s'\n", file)
 			continue
 		}
 
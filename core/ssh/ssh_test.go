@@ -0,0 +1,25 @@
+package ssh
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSingleQuote(t *testing.T) {
+	script := "read line\necho \"got=$line\"\necho 'it'\\''s' `echo ok` $((1 + 1))\n"
+
+	// the same as the remote shell runs the command of RunScript, the stdin is left for the commands of script
+	c := exec.Command("sh", "-c", "sh -c "+singleQuote(script))
+	c.Stdin = strings.NewReader("input\n")
+
+	output, err := c.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("the script fails: %s\n%s", err, output)
+	}
+
+	if want := "got=input\nit's ok 2\n"; string(output) != want {
+		t.Errorf("the script outputs %q, want %q", output, want)
+	}
+}
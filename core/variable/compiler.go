@@ -1,35 +1,312 @@
 package variable
 
 import (
+	"encoding/base64"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 var (
-	expressionReg = regexp.MustCompile("\\{\\{\\s*(\\w+)\\s*\\}\\}")
+	// the expression must start with a variable name, so the other text like `{{.Names}}` of docker is kept as it is
+	expressionReg = regexp.MustCompile(`^\s*\w+\s*(\|.*)?$`)
 )
 
-func Compile(template string, varMap map[string]string) string {
-	matchers := expressionReg.FindAllStringSubmatch(template, -1)
+// Error is the error of compiling a template. eg. the variable is undefined
+type Error struct {
+	Template string
+	Msg      string
+	Location string // where the template is used. eg. deploy.s4:3:1
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s in `%s`", e.Msg, e.Template)
+
+	if e.Location != "" {
+		return e.Location + ": " + msg
+	}
 
-	for _, matcher := range matchers {
-		key := matcher[1]
-		value := varMap[key]
+	return msg
+}
 
-		replaceReg := regexp.MustCompile(fmt.Sprintf("\\{\\{\\s*(%s)\\s*\\}\\}", key))
+// filters transform the value with the arguments. eg. {{ name | replace "-" "_" }}
+var filters = map[string]func(value string, args []string) (string, error){
+	"upper": func(value string, args []string) (string, error) {
+		return strings.ToUpper(value), expectArgs("upper", args, 0)
+	},
+	"lower": func(value string, args []string) (string, error) {
+		return strings.ToLower(value), expectArgs("lower", args, 0)
+	},
+	"trim": func(value string, args []string) (string, error) {
+		return strings.TrimSpace(value), expectArgs("trim", args, 0)
+	},
+	"base64": func(value string, args []string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(value)), expectArgs("base64", args, 0)
+	},
+	// quote the value as one argument of shell, so the backticks and `$` in it are not run. eg. it's => 'it'\''s'
+	"quote": func(value string, args []string) (string, error) {
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'", expectArgs("quote", args, 0)
+	},
+	"replace": func(value string, args []string) (string, error) {
+		if err := expectArgs("replace", args, 2); err != nil {
+			return "", err
+		}
 
-		template = replaceReg.ReplaceAllString(template, value)
+		return strings.ReplaceAll(value, args[0], args[1]), nil
+	},
+}
+
+const filterDefault = "default"
+
+func expectArgs(filter string, args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("filter `%s` expect %d arguments but got %d", filter, n, len(args))
 	}
 
-	return template
+	return nil
+}
+
+// Compile replaces the expressions in template. eg. `{{ name }}`, `{{ name | default "x" | upper }}`.
+// It returns an error if the variable is undefined and there is no default value
+func Compile(template string, varMap map[string]string) (string, error) {
+	var b strings.Builder
+
+	last := 0
+
+	err := eachExpression(template, func(start, end int, expression string) error {
+		value, err := evaluate(expression, varMap)
+
+		if err != nil {
+			return &Error{Template: template, Msg: err.Error()}
+		}
+
+		b.WriteString(template[last:start])
+		b.WriteString(value)
+
+		last = end
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	b.WriteString(template[last:])
+
+	return b.String(), nil
+}
+
+// Reference is a variable used in template
+type Reference struct {
+	Name       string
+	HasDefault bool // the variable can be undefined
+}
+
+// References returns the variables used in template in order
+func References(template string) []Reference {
+	var references []Reference
+
+	_ = eachExpression(template, func(start, end int, expression string) error {
+		segments, err := split(expression)
+
+		if err != nil {
+			return nil
+		}
+
+		reference := Reference{Name: segments[0][0]}
+
+		for _, segment := range segments[1:] {
+			if len(segment) > 0 && segment[0] == filterDefault {
+				reference.HasDefault = true
+			}
+		}
+
+		references = append(references, reference)
+
+		return nil
+	})
+
+	return references
+}
+
+// eachExpression calls fn with the range of each expression in template, including the braces
+func eachExpression(template string, fn func(start, end int, expression string) error) error {
+	offset := 0
+
+	for {
+		rest := template[offset:]
+
+		start := strings.Index(rest, "{{")
+
+		if start < 0 {
+			return nil
+		}
+
+		end := closing(rest[start+2:])
+
+		if end < 0 {
+			return nil
+		}
+
+		expression := rest[start+2 : start+2+end]
+
+		if !expressionReg.MatchString(expression) {
+			offset += start + 2
+			continue
+		}
+
+		if err := fn(offset+start, offset+start+2+end+2, expression); err != nil {
+			return err
+		}
+
+		offset += start + 2 + end + 2
+	}
 }
 
-func CompileArray(templates []string, varMap map[string]string) []string {
+func CompileArray(templates []string, varMap map[string]string) ([]string, error) {
 	var result []string
 
 	for _, template := range templates {
-		result = append(result, Compile(template, varMap))
+		s, err := Compile(template, varMap)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+// closing returns the index of `}}` which is not quoted, or -1 if it is not found
+func closing(s string) int {
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case strings.HasPrefix(s[i:], "}}"):
+			return i
+		}
+	}
+
+	return -1
+}
+
+func evaluate(expression string, varMap map[string]string) (string, error) {
+	segments, err := split(expression)
+
+	if err != nil {
+		return "", err
+	}
+
+	name := segments[0][0]
+	value, defined := varMap[name]
+
+	for _, segment := range segments[1:] {
+		if len(segment) == 0 {
+			return "", fmt.Errorf("missing filter")
+		}
+
+		filter, args := segment[0], segment[1:]
+
+		if filter == filterDefault {
+			if err := expectArgs(filterDefault, args, 1); err != nil {
+				return "", err
+			}
+
+			// the default value is used if the variable is undefined or empty
+			if !defined || value == "" {
+				value, defined = args[0], true
+			}
+
+			continue
+		}
+
+		fn, ok := filters[filter]
+
+		if !ok {
+			return "", fmt.Errorf("unknown filter `%s`", filter)
+		}
+
+		// the filters before `default` are skipped if the variable is undefined
+		if !defined {
+			continue
+		}
+
+		if value, err = fn(value, args); err != nil {
+			return "", err
+		}
+	}
+
+	if !defined {
+		return "", fmt.Errorf("undefined variable `%s`", name)
+	}
+
+	return value, nil
+}
+
+// split splits the expression into the variable name and the filters with their arguments.
+// The arguments can be quoted. eg. `name | replace "-" "_"` => [[name] [replace - _]]
+func split(expression string) ([][]string, error) {
+	segments := [][]string{{}}
+
+	s := expression
+
+	for len(s) > 0 {
+		switch c := s[0]; {
+		case c == ' ' || c == '\t':
+			s = s[1:]
+		case c == '|':
+			segments = append(segments, []string{})
+			s = s[1:]
+		case c == '"' || c == '\'':
+			i := 1
+			for ; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && c == '"' {
+					i++
+				}
+			}
+
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string %s", s)
+			}
+
+			arg := s[1:i]
+
+			if c == '"' {
+				unquoted, err := strconv.Unquote(s[:i+1])
+
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s", s[:i+1])
+				}
+
+				arg = unquoted
+			}
+
+			segments[len(segments)-1] = append(segments[len(segments)-1], arg)
+			s = s[i+1:]
+		default:
+			i := strings.IndexAny(s, " \t|\"'")
+
+			if i < 0 {
+				i = len(s)
+			}
+
+			segments[len(segments)-1] = append(segments[len(segments)-1], s[:i])
+			s = s[i:]
+		}
 	}
 
-	return result
+	return segments, nil
 }
@@ -12,9 +12,10 @@ func TestCompile(t *testing.T) {
 		varMap   map[string]string
 	}
 	tests := []struct {
-		name string
-		args args
-		want string
+		name    string
+		args    args
+		want    string
+		wantErr bool
 	}{
 		{
 			name: "basic",
@@ -47,12 +48,112 @@ func TestCompile(t *testing.T) {
 					//"city": "CK", // the missing variable
 				},
 			},
-			want: "hello test, I am 18 years old. I live in ",
+			wantErr: true,
+		},
+		{
+			name: "default value",
+			args: args{
+				template: `/{{ APP_DIR | default "srv/app" }}/{{ name | default 'x' }}/{{ empty | default "y" }}`,
+				varMap: map[string]string{
+					"name":  "test",
+					"empty": "",
+				},
+			},
+			want: "/srv/app/test/y",
+		},
+		{
+			name: "filters",
+			args: args{
+				template: `{{ name | trim | upper }} {{ name | lower | replace " " "-" | trim }} {{ env | default "prod" | base64 }}`,
+				varMap: map[string]string{
+					"name": " Hello World ",
+				},
+			},
+			want: "HELLO WORLD -hello-world- cHJvZA==",
+		},
+		{
+			name: "default after filters",
+			args: args{
+				template: `{{ env | upper | default "prod" }} {{ name | upper | default "x" }} {{ blank | trim | default "y" }}`,
+				varMap: map[string]string{
+					"name":  "test",
+					"blank": "  ",
+				},
+			},
+			want: "prod TEST y",
+		},
+		{
+			name: "undefined variable with filters",
+			args: args{
+				template: `{{ env | upper | lower }}`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "quote filter",
+			args: args{
+				template: "echo {{ error | quote }}",
+				varMap: map[string]string{
+					"error": "`ASSERT $VERSION` failed, it's `1.4.1`",
+				},
+			},
+			want: "echo '`ASSERT $VERSION` failed, it'\\''s `1.4.1`'",
+		},
+		{
+			name: "quoted arguments",
+			args: args{
+				template: `{{ name | replace "}}" "\"" }}`,
+				varMap: map[string]string{
+					"name": "a}}b",
+				},
+			},
+			want: `a"b`,
+		},
+		{
+			name: "not a variable",
+			args: args{
+				template: `docker ps --format '{{.Names}}' {{ }} {{name}`,
+				varMap:   map[string]string{},
+			},
+			want: `docker ps --format '{{.Names}}' {{ }} {{name}`,
+		},
+		{
+			name: "unknown filter",
+			args: args{
+				template: "{{ name | camel }}",
+				varMap: map[string]string{
+					"name": "test",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong number of arguments",
+			args: args{
+				template: `{{ name | replace "a" }}`,
+				varMap: map[string]string{
+					"name": "test",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "filter of undefined variable",
+			args: args{
+				template: "{{ name | upper }}",
+				varMap:   map[string]string{},
+			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := variable.Compile(tt.args.template, tt.args.varMap); got != tt.want {
+			got, err := variable.Compile(tt.args.template, tt.args.varMap)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
 				t.Errorf("Compile() = %v, want %v", got, tt.want)
 			}
 		})
@@ -65,9 +166,10 @@ func TestCompileArray(t *testing.T) {
 		varMap    map[string]string
 	}
 	tests := []struct {
-		name string
-		args args
-		want []string
+		name    string
+		args    args
+		want    []string
+		wantErr bool
 	}{
 		{
 			name: "basic",
@@ -79,12 +181,60 @@ func TestCompileArray(t *testing.T) {
 			},
 			want: []string{"hello test"},
 		},
+		{
+			name: "missing variables",
+			args: args{
+				templates: []string{"hello {{name}}", "{{city}}"},
+				varMap: map[string]string{
+					"name": "test",
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := variable.CompileArray(tt.args.templates, tt.args.varMap); !reflect.DeepEqual(got, tt.want) {
+			got, err := variable.CompileArray(tt.args.templates, tt.args.varMap)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CompileArray() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("CompileArray() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []variable.Reference
+	}{
+		{
+			name:     "no variables",
+			template: "hello world",
+		},
+		{
+			name:     "variables",
+			template: "{{ name }} {{ city | upper }} {{ port | default 22 }}",
+			want: []variable.Reference{
+				{Name: "name"},
+				{Name: "city"},
+				{Name: "port", HasDefault: true},
+			},
+		},
+		{
+			name:     "not variables",
+			template: "docker ps --format {{.Names}}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := variable.References(tt.template); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("References() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
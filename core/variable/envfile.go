@@ -0,0 +1,90 @@
+package variable
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var envLineReg = regexp.MustCompile(`^(?:export\s+)?(\w+)\s*=\s*(.*)$`)
+
+// ParseEnvFile parses the content of env file. eg.
+//
+//	# comment
+//	TARGET=prod
+//	export VERSION = 1.0.0
+//	MESSAGE="hello world" # comment
+//
+// The double quoted values support the escape sequences, the single quoted values are kept as they are
+func ParseEnvFile(content string) (map[string]string, error) {
+	vars := map[string]string{}
+
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m := envLineReg.FindStringSubmatch(line)
+
+		if m == nil {
+			return nil, fmt.Errorf("line %d: invalid format `%s`, expect `KEY=VALUE`", i+1, line)
+		}
+
+		value, err := parseEnvValue(m[2])
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		vars[m[1]] = value
+	}
+
+	return vars, nil
+}
+
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value, '"')
+
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value `%s`", value)
+		}
+
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, `'`):
+		end := closingQuote(value, '\'')
+
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value `%s`", value)
+		}
+
+		return value[1:end], nil
+	}
+
+	// the comment after the value. eg. `KEY=value # comment`
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the quote which closes the value
+func closingQuote(value string, quote byte) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+
+	return -1
+}
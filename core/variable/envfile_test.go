@@ -0,0 +1,59 @@
+package variable_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axetroy/s4/core/variable"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "basic",
+			content: "# comment\n\nTARGET=prod\nexport VERSION = 1.0.0\r\nEMPTY=\n",
+			want: map[string]string{
+				"TARGET":  "prod",
+				"VERSION": "1.0.0",
+				"EMPTY":   "",
+			},
+		},
+		{
+			name:    "quoted values",
+			content: "A=\"hello world\" # comment\nB='{{name}} \\n'\nC=\"line\\nbreak\"\nD=a # comment",
+			want: map[string]string{
+				"A": "hello world",
+				"B": "{{name}} \\n",
+				"C": "line\nbreak",
+				"D": "a",
+			},
+		},
+		{
+			name:    "invalid line",
+			content: "TARGET prod",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated quote",
+			content: "A=\"hello",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := variable.ParseEnvFile(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEnvFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnvFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
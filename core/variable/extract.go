@@ -0,0 +1,301 @@
+package variable
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExtractJSON  = "json"
+	ExtractRegex = "regex"
+	ExtractLine  = "line"
+)
+
+var (
+	extractReg  = regexp.MustCompile(`^(json|regex|line)(?:\s+(.*))?$`)
+	jsonPathReg = regexp.MustCompile(`^(?:\.[\w-]+|\[-?\d+\])`)
+)
+
+// Extractor extracts a part of the stdout of command. eg. `VAR VERSION <= cat package.json | json .version`
+type Extractor struct {
+	Mode string `json:"mode"` // json, regex or line
+	Arg  string `json:"arg"`  // the path of json, the pattern of regex or the number of line
+}
+
+// splitExtractors splits the extractors at the end of command. eg. `docker ps | line 2 | regex "^(\w+)"`
+// The other pipes are kept in the command. eg. `ls | wc -l`
+func splitExtractors(command string) (string, []Extractor, error) {
+	var extractors []Extractor
+
+	pipes := pipeIndexes(command)
+
+	for i := len(pipes) - 1; i >= 0; i-- {
+		m := extractReg.FindStringSubmatch(strings.TrimSpace(command[pipes[i]+1:]))
+
+		if m == nil {
+			break
+		}
+
+		extractor, err := newExtractor(m[1], strings.TrimSpace(m[2]))
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		extractors = append([]Extractor{extractor}, extractors...)
+		command = strings.TrimSpace(command[:pipes[i]])
+	}
+
+	if len(extractors) > 0 && command == "" {
+		return "", nil, fmt.Errorf("require a command before `| %s`", extractors[0].Mode)
+	}
+
+	return command, extractors, nil
+}
+
+// PipedExtractors returns the names of extractors which are in the middle of command. They are not taken as extractors,
+// but run as the commands of shell. eg. `cat package.json | json .version | wc -c`
+func PipedExtractors(command string) []string {
+	var names []string
+
+	pipes := pipeIndexes(command)
+
+	for i, index := range pipes {
+		end := len(command)
+
+		if i+1 < len(pipes) {
+			end = pipes[i+1]
+		}
+
+		if m := extractReg.FindStringSubmatch(strings.TrimSpace(command[index+1 : end])); m != nil {
+			names = append(names, m[1])
+		}
+	}
+
+	return names
+}
+
+// pipeIndexes returns the indexes of `|` which are not quoted or in the template, `||` is not a pipe
+func pipeIndexes(command string) []int {
+	var (
+		indexes  []int
+		quote    byte
+		template bool
+	)
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case template:
+			if strings.HasPrefix(command[i:], "}}") {
+				template = false
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(command[i:], "{{"):
+			template = true
+			i++
+		case strings.HasPrefix(command[i:], "||"):
+			i++
+		case c == '|':
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+func newExtractor(mode string, arg string) (Extractor, error) {
+	// the quotes are optional. eg. regex "v(\d+)"
+	if len(arg) > 1 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+		arg = strings.ReplaceAll(arg[1:len(arg)-1], `\`+arg[:1], arg[:1])
+	}
+
+	if arg == "" {
+		return Extractor{}, fmt.Errorf("`%s` require an argument", mode)
+	}
+
+	switch mode {
+	case ExtractJSON:
+		if _, err := parseJSONPath(arg); err != nil {
+			return Extractor{}, err
+		}
+	case ExtractRegex:
+		if _, err := regexp.Compile(arg); err != nil {
+			return Extractor{}, fmt.Errorf("invalid regex `%s`: %s", arg, err)
+		}
+	case ExtractLine:
+		if n, err := strconv.Atoi(arg); err != nil || n == 0 {
+			return Extractor{}, fmt.Errorf("`%s` require a line number but got `%s`", mode, arg)
+		}
+	}
+
+	return Extractor{Mode: mode, Arg: arg}, nil
+}
+
+// parseJSONPath parses the path of json. eg. `.data.items[0].name`
+func parseJSONPath(path string) ([]string, error) {
+	var segments []string
+
+	if path == "." {
+		return segments, nil
+	}
+
+	for rest := path; rest != ""; {
+		segment := jsonPathReg.FindString(rest)
+
+		if segment == "" {
+			return nil, fmt.Errorf("invalid json path `%s`, expect the format like `.data.items[0].name`", path)
+		}
+
+		segments = append(segments, segment)
+		rest = rest[len(segment):]
+	}
+
+	return segments, nil
+}
+
+// Extract extracts a part of the output with the extractors in order
+func Extract(output string, extractors []Extractor) (string, error) {
+	var err error
+
+	for _, extractor := range extractors {
+		switch extractor.Mode {
+		case ExtractJSON:
+			output, err = extractJSON(output, extractor.Arg)
+		case ExtractRegex:
+			output, err = extractRegex(output, extractor.Arg)
+		case ExtractLine:
+			output, err = extractLine(output, extractor.Arg)
+		default:
+			err = fmt.Errorf("invalid extractor `%s`", extractor.Mode)
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return output, nil
+}
+
+// extractJSON returns the value of the path. The string is not quoted, the object and array are in JSON
+func extractJSON(output string, path string) (string, error) {
+	segments, err := parseJSONPath(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	// the numbers are kept as they are, the large integers lose the precision in float64
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("the output is not valid JSON: %s", err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", fmt.Errorf("the output is not valid JSON: unexpected data after the value")
+	}
+
+	for _, segment := range segments {
+		var ok bool
+
+		if strings.HasPrefix(segment, ".") {
+			var object map[string]interface{}
+
+			if object, ok = value.(map[string]interface{}); ok {
+				value, ok = object[segment[1:]]
+			}
+		} else {
+			var array []interface{}
+
+			if array, ok = value.([]interface{}); ok {
+				index, _ := strconv.Atoi(segment[1 : len(segment)-1])
+
+				if index < 0 {
+					index += len(array)
+				}
+
+				if ok = index >= 0 && index < len(array); ok {
+					value = array[index]
+				}
+			}
+		}
+
+		if !ok {
+			return "", fmt.Errorf("json path `%s` not found in the output", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		b, err := json.Marshal(v)
+
+		return string(b), err
+	}
+}
+
+// extractRegex returns the first group of the first match, or the whole match if there is no group
+func extractRegex(output string, pattern string) (string, error) {
+	reg, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return "", err
+	}
+
+	m := reg.FindStringSubmatch(output)
+
+	if m == nil {
+		return "", fmt.Errorf("regex `%s` does not match the output", pattern)
+	}
+
+	if len(m) > 1 {
+		return m[1], nil
+	}
+
+	return m[0], nil
+}
+
+// extractLine returns the line of output, it starts from 1. The negative number counts from the end
+func extractLine(output string, arg string) (string, error) {
+	n, err := strconv.Atoi(arg)
+
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+
+	index := n - 1
+
+	if n < 0 {
+		index = len(lines) + n
+	}
+
+	if index < 0 || index >= len(lines) {
+		return "", fmt.Errorf("line %d is out of the output of %d lines", n, len(lines))
+	}
+
+	return strings.TrimSpace(lines[index]), nil
+}
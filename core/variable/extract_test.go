@@ -0,0 +1,227 @@
+package variable_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axetroy/s4/core/variable"
+)
+
+func TestParseExtractors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *variable.Variable
+		wantErr bool
+	}{
+		{
+			name:  "json",
+			input: "VERSION <= cat package.json | json .data.version",
+			want: &variable.Variable{
+				Key:        "VERSION",
+				Value:      "cat package.json",
+				Type:       variable.TypeCommand,
+				Remote:     true,
+				Extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".data.version"}},
+			},
+		},
+		{
+			name:  "chained with shell pipes",
+			input: `ID <= LOCAL docker ps | grep api || true | line 2 | regex "^(\w+|-)"`,
+			want: &variable.Variable{
+				Key:    "ID",
+				Value:  "docker ps | grep api || true",
+				Type:   variable.TypeCommand,
+				Shell:  true,
+				Remote: false,
+				Extractors: []variable.Extractor{
+					{Mode: variable.ExtractLine, Arg: "2"},
+					{Mode: variable.ExtractRegex, Arg: `^(\w+|-)`},
+				},
+			},
+		},
+		{
+			name:  "json array",
+			input: `VERSION <= ["node", "-v"] | regex 'v(\d+)'`,
+			want: &variable.Variable{
+				Key:        "VERSION",
+				Value:      "node -v",
+				Type:       variable.TypeCommand,
+				Remote:     false,
+				Extractors: []variable.Extractor{{Mode: variable.ExtractRegex, Arg: `v(\d+)`}},
+			},
+		},
+		{
+			name:  "pipe in template",
+			input: "NAME <= echo {{ name | upper }}",
+			want: &variable.Variable{
+				Key:    "NAME",
+				Value:  "echo {{ name | upper }}",
+				Type:   variable.TypeCommand,
+				Remote: true,
+			},
+		},
+		{
+			name:  "command named as extractor",
+			input: "VERSION <= cat package.json | command json version",
+			want: &variable.Variable{
+				Key:    "VERSION",
+				Value:  "cat package.json | command json version",
+				Type:   variable.TypeCommand,
+				Remote: true,
+			},
+		},
+		{
+			name:    "invalid line number",
+			input:   "LINE <= ls | line first",
+			wantErr: true,
+		},
+		{
+			name:    "invalid json path",
+			input:   "VERSION <= cat package.json | json data",
+			wantErr: true,
+		},
+		{
+			name:    "without command",
+			input:   "VERSION <= | json .version",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := variable.Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipedExtractors(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{command: "cat package.json | json .version | wc -c", want: []string{"json"}},
+		{command: "docker ps | line 2 | grep api | regex ^a | tail -1", want: []string{"line", "regex"}},
+		{command: "cat package.json | command json version | wc -c"},
+		{command: `echo "| json .a" {{ a | line }}`},
+		{command: "ls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := variable.PipedExtractors(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PipedExtractors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		extractors []variable.Extractor
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "json string",
+			output:     `{"data": {"version": "1.2.3"}}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".data.version"}},
+			want:       "1.2.3",
+		},
+		{
+			name:       "json array and number",
+			output:     `{"items": [{"id": 1}, {"id": 2}]}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".items[-1].id"}},
+			want:       "2",
+		},
+		{
+			name:       "json large integer",
+			output:     `{"id": 12345678901234567890, "ratio": 1.50, "list": [9007199254740993]}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".id"}},
+			want:       "12345678901234567890",
+		},
+		{
+			name:       "json large integer in array",
+			output:     `{"id": 12345678901234567890, "ratio": 1.50, "list": [9007199254740993]}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".list"}},
+			want:       "[9007199254740993]",
+		},
+		{
+			name:       "json with trailing data",
+			output:     `{"version": "1.2.3"} {}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".version"}},
+			wantErr:    true,
+		},
+		{
+			name:       "json object",
+			output:     `{"data": {"a": true}}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".data"}},
+			want:       `{"a":true}`,
+		},
+		{
+			name:       "json path not found",
+			output:     `{"data": {}}`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".data.version"}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid json",
+			output:     `v1.2.3`,
+			extractors: []variable.Extractor{{Mode: variable.ExtractJSON, Arg: ".version"}},
+			wantErr:    true,
+		},
+		{
+			name:       "regex group",
+			output:     "node v16.13.0",
+			extractors: []variable.Extractor{{Mode: variable.ExtractRegex, Arg: `v(\d+\.\d+)`}},
+			want:       "16.13",
+		},
+		{
+			name:       "regex without group",
+			output:     "node v16.13.0",
+			extractors: []variable.Extractor{{Mode: variable.ExtractRegex, Arg: `\d+`}},
+			want:       "16",
+		},
+		{
+			name:       "regex not match",
+			output:     "node",
+			extractors: []variable.Extractor{{Mode: variable.ExtractRegex, Arg: `\d+`}},
+			wantErr:    true,
+		},
+		{
+			name:   "line then regex",
+			output: "CONTAINER ID   IMAGE\r\n4c01db0b339c   nginx\n5d1ba3e4f2a0   redis",
+			extractors: []variable.Extractor{
+				{Mode: variable.ExtractLine, Arg: "-1"},
+				{Mode: variable.ExtractRegex, Arg: `^\w+`},
+			},
+			want: "5d1ba3e4f2a0",
+		},
+		{
+			name:       "line out of range",
+			output:     "a\nb",
+			extractors: []variable.Extractor{{Mode: variable.ExtractLine, Arg: "3"}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := variable.Extract(tt.output, tt.extractors)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
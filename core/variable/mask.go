@@ -0,0 +1,37 @@
+package variable
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaskText replaces the secret in the output
+const MaskText = "***"
+
+// Mask replaces the secrets in the text with `***`. The longer secret is replaced first, so it is not partly revealed by a shorter one
+func Mask(text string, secrets []string) string {
+	var sorted []string
+
+	for _, secret := range secrets {
+		// the empty value is not a secret, or it masks everything
+		if secret != "" {
+			sorted = append(sorted, secret)
+		}
+	}
+
+	if len(sorted) == 0 {
+		return text
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	var pairs []string
+
+	for _, secret := range sorted {
+		pairs = append(pairs, secret, MaskText)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
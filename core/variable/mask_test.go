@@ -0,0 +1,48 @@
+package variable_test
+
+import (
+	"testing"
+
+	"github.com/axetroy/s4/core/variable"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		secrets []string
+		want    string
+	}{
+		{
+			name:    "no secrets",
+			text:    "hunter2",
+			secrets: nil,
+			want:    "hunter2",
+		},
+		{
+			name:    "empty secret",
+			text:    "hunter2",
+			secrets: []string{""},
+			want:    "hunter2",
+		},
+		{
+			name:    "multiple occurrences",
+			text:    "login with hunter2, then hunter2",
+			secrets: []string{"hunter2"},
+			want:    "login with ***, then ***",
+		},
+		{
+			name:    "longer secret first",
+			text:    "token abc and abcdef",
+			secrets: []string{"abc", "abcdef"},
+			want:    "token *** and ***",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := variable.Mask(tt.text, tt.secrets); got != tt.want {
+				t.Errorf("Mask() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,9 @@ type Variable struct {
 	Value  string
 	Type   Type
 	Remote bool // If running with a command or get environmental variable, is it running remotely?
+	Shell  bool // If running with a command, is it running with the shell of local? eg. `LOCAL ls | wc -l`
+
+	Extractors []Extractor // If running with a command, extract a part of the stdout. eg. `cat package.json | json .version`
 }
 
 var (
@@ -46,7 +49,7 @@ func Parse(input string) (*Variable, error) {
 	switch action {
 	case "=":
 		// set env
-		envReg := regexp.MustCompile("^\\$([A-Z]+):([a-z]+)\\s*$")
+		envReg := regexp.MustCompile("^\\$([A-Za-z_][A-Za-z0-9_]*):([a-z]+)\\s*$")
 
 		if envReg.MatchString(value) {
 			matchers := envReg.FindStringSubmatch(value)
@@ -73,8 +76,23 @@ func Parse(input string) (*Variable, error) {
 	default:
 		// <=
 		v.Type = TypeCommand
-		// if command defined as JSON array. eg ["npm", "version"]. this should run in local
-		if strings.Index(value, "[") == 0 {
+
+		command, extractors, err := splitExtractors(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value = command
+		v.Extractors = extractors
+
+		// if command starts with LOCAL. eg LOCAL git rev-parse HEAD. this should run with the shell of local
+		if strings.HasPrefix(value, "LOCAL ") {
+			v.Value = strings.TrimSpace(strings.TrimPrefix(value, "LOCAL "))
+			v.Remote = false
+			v.Shell = true
+		} else if strings.Index(value, "[") == 0 {
+			// if command defined as JSON array. eg ["npm", "version"]. this should run in local
 			var commands []string
 
 			if err := json.Unmarshal([]byte(value), &commands); err != nil {
@@ -52,6 +52,41 @@ func TestParse(t *testing.T) {
 				Remote: true,
 			},
 		},
+		{
+			name: "env with underscores and digits",
+			args: args{
+				input: "TOKEN = $DEPLOY_TOKEN_2:local",
+			},
+			want: &variable.Variable{
+				Key:    "TOKEN",
+				Value:  "DEPLOY_TOKEN_2",
+				Type:   variable.TypeEnv,
+				Remote: false,
+			},
+		},
+		{
+			name: "env in lowercase",
+			args: args{
+				input: "HOME_DIR = $_home:remote",
+			},
+			want: &variable.Variable{
+				Key:    "HOME_DIR",
+				Value:  "_home",
+				Type:   variable.TypeEnv,
+				Remote: true,
+			},
+		},
+		{
+			name: "env can not start with digit",
+			args: args{
+				input: "TOKEN = $1TOKEN:local",
+			},
+			want: &variable.Variable{
+				Key:   "TOKEN",
+				Value: "$1TOKEN:local",
+				Type:  variable.TypeLiteral,
+			},
+		},
 		{
 			name: "basic local command",
 			args: args{
@@ -64,6 +99,19 @@ func TestParse(t *testing.T) {
 				Remote: false,
 			},
 		},
+		{
+			name: "local shell command",
+			args: args{
+				input: `VERSION <= LOCAL git describe --tags | tr -d v`,
+			},
+			want: &variable.Variable{
+				Key:    "VERSION",
+				Value:  `git describe --tags | tr -d v`,
+				Type:   variable.TypeCommand,
+				Remote: false,
+				Shell:  true,
+			},
+		},
 		{
 			name: "basic remote command",
 			args: args{
@@ -51,6 +51,18 @@ SOURCE CODE:
 			Usage:   "specify the s4 configuration file.",
 			Value:   ".s4", // default value
 		},
+		&cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "set the variable `KEY=VALUE`, it can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "var-file",
+			Usage: "set the variables from the env `FILE`, it can be repeated",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "stop the workflow if it does not finish in the `DURATION`, eg. 30m",
+		},
 	}
 
 	app.Commands = []*cli.Command{
@@ -68,6 +80,85 @@ SOURCE CODE:
 				return command.Upgrade()
 			},
 		},
+		{
+			Name:      "run",
+			Usage:     "Run a task and its dependencies",
+			ArgsUsage: "<task>",
+			Action: func(c *cli.Context) error {
+				vars, err := command.Variables(c.StringSlice("var-file"), c.StringSlice("var"))
+
+				if err != nil {
+					return err
+				}
+
+				return command.Run(c.String("config"), c.Args().First(), vars, c.Duration("timeout"))
+			},
+		},
+		{
+			Name:      "check",
+			Usage:     "Validate the s4 files without connecting to the server",
+			ArgsUsage: "[files...]",
+			Action: func(c *cli.Context) error {
+				files := c.Args().Slice()
+
+				if len(files) == 0 {
+					files = []string{c.String("config")}
+				}
+
+				return command.Check(files)
+			},
+		},
+		{
+			Name:      "fmt",
+			Usage:     "Format the s4 files",
+			ArgsUsage: "[files...]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "check",
+					Usage: "exit with error if the files are not formatted, without writing them",
+				},
+				&cli.BoolFlag{
+					Name:  "diff",
+					Usage: "print the changes instead of writing the files",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				files := c.Args().Slice()
+
+				if len(files) == 0 {
+					files = []string{c.String("config")}
+				}
+
+				return command.Fmt(files, c.Bool("check"), c.Bool("diff"))
+			},
+		},
+		{
+			Name:      "parse",
+			Usage:     "Print the parsed workflow",
+			ArgsUsage: "[file]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the tokens as JSON",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				file := c.Args().First()
+
+				if file == "" {
+					file = c.String("config")
+				}
+
+				return command.Parse(file, c.Bool("json"))
+			},
+		},
+		{
+			Name:  "lsp",
+			Usage: "Run the language server over stdio for editor integration",
+			Action: func(c *cli.Context) error {
+				return command.Lsp()
+			},
+		},
 		{
 			Name:  "init",
 			Usage: "Initialize an s4 file",
@@ -79,7 +170,14 @@ SOURCE CODE:
 
 	app.Action = func(c *cli.Context) error {
 		configFile := c.String("config")
-		return command.Default(configFile)
+
+		vars, err := command.Variables(c.StringSlice("var-file"), c.StringSlice("var"))
+
+		if err != nil {
+			return err
+		}
+
+		return command.Default(configFile, vars, c.Duration("timeout"))
 	}
 
 	if err := app.Run(os.Args); err != nil {